@@ -18,15 +18,9 @@ func main() {
 	}
 	defer x360Gamepad.Close()
 
-	// Press a button to wake the device up
-	fmt.Println("Pressing A button...")
-	x360Gamepad.PressButton(commons.XUSB_GAMEPAD_A)
-	x360Gamepad.Update()
-	time.Sleep(500 * time.Millisecond)
-
-	fmt.Println("Releasing A button...")
-	x360Gamepad.ReleaseButton(commons.XUSB_GAMEPAD_A)
-	x360Gamepad.Update()
+	// Tap a button to wake the device up
+	fmt.Println("Tapping A button...")
+	x360Gamepad.Tap(commons.XUSB_GAMEPAD_A, 500*time.Millisecond).Wait()
 	time.Sleep(500 * time.Millisecond)
 
 	// Press buttons and things
@@ -66,15 +60,9 @@ func main() {
 	}
 	defer ds4Gamepad.Close()
 
-	// Press a button to wake the device up
-	fmt.Println("Pressing Triangle button...")
-	ds4Gamepad.PressButton(commons.DS4_BUTTON_TRIANGLE)
-	ds4Gamepad.Update()
-	time.Sleep(500 * time.Millisecond)
-
-	fmt.Println("Releasing Triangle button...")
-	ds4Gamepad.ReleaseButton(commons.DS4_BUTTON_TRIANGLE)
-	ds4Gamepad.Update()
+	// Tap a button to wake the device up
+	fmt.Println("Tapping Triangle button...")
+	ds4Gamepad.Tap(commons.DS4_BUTTON_TRIANGLE, 500*time.Millisecond).Wait()
 	time.Sleep(500 * time.Millisecond)
 
 	// Press buttons and things
@@ -73,8 +73,10 @@ func NewViGEmClient() (*ViGEmClient, error) {
 
 	dll, err := syscall.LoadDLL(dllPath)
 	if err != nil {
+		commons.Log(commons.LogError, "failed to load ViGEmClient.dll", "path", dllPath, "error", err)
 		return nil, fmt.Errorf("failed to load ViGEmClient.dll: %w", err)
 	}
+	commons.Log(commons.LogDebug, "loaded ViGEmClient.dll", "path", dllPath)
 
 	client := &ViGEmClient{
 		dll: dll,
@@ -231,6 +233,7 @@ func extractDLL() (string, error) {
 	// Check if DLL exists and is current
 	if _, err := os.Stat(dllPath); err == nil {
 		// DLL exists, we can use it
+		commons.Log(commons.LogDebug, "using the extracted DLL", "path", dllPath)
 		return dllPath, nil
 	}
 
@@ -248,8 +251,10 @@ func extractDLL() (string, error) {
 
 	// Write the DLL to the temporary location
 	if err := os.WriteFile(dllPath, dllData, 0644); err != nil {
+		commons.Log(commons.LogError, "failed to extract the DLL", "path", dllPath, "error", err)
 		return "", fmt.Errorf("failed to write DLL to temp location: %w", err)
 	}
+	commons.Log(commons.LogInfo, "extracted the DLL", "path", dllPath, "arch", arch)
 
 	return dllPath, nil
 }
@@ -263,8 +268,10 @@ func ensureViGEmBusInstalled() error {
 	}
 
 	if installed {
+		commons.Log(commons.LogDebug, "ViGEmBus is installed")
 		return nil
 	}
+	commons.Log(commons.LogInfo, "ViGEmBus is not installed, running the installer", "version", VIGEMBUS_VERSION)
 
 	arch, err := getArch()
 	if err != nil {
@@ -293,11 +300,13 @@ func ensureViGEmBusInstalled() error {
 	cmd := exec.Command("msiexec", "/i", msiPath, "/quiet", "/norestart")
 	err = cmd.Run()
 	if err != nil {
+		commons.Log(commons.LogError, "failed to install ViGEmBus", "path", msiPath, "error", err)
 		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1603 {
 			return fmt.Errorf("failed to run installer (exit code 1603) - You may need to run as administrator: %w", err)
 		}
 		return fmt.Errorf("failed to run installer: %w", err)
 	}
+	commons.Log(commons.LogInfo, "installed ViGEmBus", "version", VIGEMBUS_VERSION)
 
 	return nil
 }
@@ -334,7 +343,7 @@ func isViGEmBusInstalled() (bool, error) {
 		}
 	}
 
-	fmt.Println("Checking registry for ViGEmBus installation...")
+	commons.Log(commons.LogDebug, "checking registry for ViGEmBus installation")
 	// Fallback to registry check
 	cmd := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`, "/s")
 	output, err := cmd.Output()
@@ -33,6 +33,9 @@ const (
 	XUSB_GAMEPAD_Y              XUSBButton = 0x8000
 )
 
+// XUSB_GAMEPAD_DPAD is the mask of all the XUSB D-pad buttons
+const XUSB_GAMEPAD_DPAD = XUSB_GAMEPAD_DPAD_UP | XUSB_GAMEPAD_DPAD_DOWN | XUSB_GAMEPAD_DPAD_LEFT | XUSB_GAMEPAD_DPAD_RIGHT
+
 // XUSBReport represents an XINPUT_GAMEPAD-compatible report structure
 type XUSBReport struct {
 	WButtons      uint16
@@ -224,3 +227,42 @@ func DS4ReportInit(report *DS4Report) {
 	report.BThumbRY = 0x80
 	DS4SetDPad(report, DS4_BUTTON_DPAD_NONE)
 }
+
+// xusbDPadDirections lists the XUSB D-pad buttons of each DS4DPadDirection
+var xusbDPadDirections = [...]XUSBButton{
+	DS4_BUTTON_DPAD_NORTH:     XUSB_GAMEPAD_DPAD_UP,
+	DS4_BUTTON_DPAD_NORTHEAST: XUSB_GAMEPAD_DPAD_UP | XUSB_GAMEPAD_DPAD_RIGHT,
+	DS4_BUTTON_DPAD_EAST:      XUSB_GAMEPAD_DPAD_RIGHT,
+	DS4_BUTTON_DPAD_SOUTHEAST: XUSB_GAMEPAD_DPAD_DOWN | XUSB_GAMEPAD_DPAD_RIGHT,
+	DS4_BUTTON_DPAD_SOUTH:     XUSB_GAMEPAD_DPAD_DOWN,
+	DS4_BUTTON_DPAD_SOUTHWEST: XUSB_GAMEPAD_DPAD_DOWN | XUSB_GAMEPAD_DPAD_LEFT,
+	DS4_BUTTON_DPAD_WEST:      XUSB_GAMEPAD_DPAD_LEFT,
+	DS4_BUTTON_DPAD_NORTHWEST: XUSB_GAMEPAD_DPAD_UP | XUSB_GAMEPAD_DPAD_LEFT,
+	DS4_BUTTON_DPAD_NONE:      0,
+}
+
+// DS4DPadToXUSB returns the XUSB D-pad buttons matching a directional pad (hat) value
+func DS4DPadToXUSB(dpad DS4DPadDirection) XUSBButton {
+	if int(dpad) >= len(xusbDPadDirections) {
+		return 0
+	}
+	return xusbDPadDirections[dpad]
+}
+
+// XUSBToDS4DPad returns the directional pad (hat) value matching the XUSB D-pad buttons in buttons.
+// Opposite directions cancel each other out.
+func XUSBToDS4DPad(buttons XUSBButton) DS4DPadDirection {
+	buttons &= XUSB_GAMEPAD_DPAD
+	if buttons&(XUSB_GAMEPAD_DPAD_UP|XUSB_GAMEPAD_DPAD_DOWN) == XUSB_GAMEPAD_DPAD_UP|XUSB_GAMEPAD_DPAD_DOWN {
+		buttons &^= XUSB_GAMEPAD_DPAD_UP | XUSB_GAMEPAD_DPAD_DOWN
+	}
+	if buttons&(XUSB_GAMEPAD_DPAD_LEFT|XUSB_GAMEPAD_DPAD_RIGHT) == XUSB_GAMEPAD_DPAD_LEFT|XUSB_GAMEPAD_DPAD_RIGHT {
+		buttons &^= XUSB_GAMEPAD_DPAD_LEFT | XUSB_GAMEPAD_DPAD_RIGHT
+	}
+	for dpad, b := range xusbDPadDirections {
+		if b == buttons {
+			return DS4DPadDirection(dpad)
+		}
+	}
+	return DS4_BUTTON_DPAD_NONE
+}
@@ -0,0 +1,73 @@
+package commons
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// LogLevel is the severity of a log message
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota // Details of the normal operation
+	LogInfo                  // Bus connections, targets added and removed
+	LogWarn                  // Recoverable problems, such as a dropped target
+	LogError                 // Failed operations
+)
+
+// String returns a string representation of the LogLevel
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Logger receives the log messages of the library.
+// keyvals are alternating keys (strings) and values giving the context of the message.
+type Logger interface {
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc is a function used as a Logger
+type LoggerFunc func(level LogLevel, msg string, keyvals ...interface{})
+
+// Log calls the function
+func (f LoggerFunc) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// loggerBox holds the logger, so that nil can be stored
+type loggerBox struct {
+	logger Logger
+}
+
+// Current logger of the library
+var logger atomic.Pointer[loggerBox]
+
+// SetLogger sets the logger of the library, nil (the default) discards the log messages
+func SetLogger(l Logger) {
+	logger.Store(&loggerBox{logger: l})
+}
+
+// GetLogger returns the logger of the library, nil if the log messages are discarded
+func GetLogger() Logger {
+	if box := logger.Load(); box != nil {
+		return box.logger
+	}
+	return nil
+}
+
+// Log sends a message to the logger of the library, if there is one
+func Log(level LogLevel, msg string, keyvals ...interface{}) {
+	if l := GetLogger(); l != nil {
+		l.Log(level, msg, keyvals...)
+	}
+}
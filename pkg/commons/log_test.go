@@ -0,0 +1,104 @@
+package commons
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// recordedLog is a message received by a test logger
+type recordedLog struct {
+	level   LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+func TestLoggerIsSilentByDefault(t *testing.T) {
+	if l := GetLogger(); l != nil {
+		t.Fatalf("GetLogger() = %v before any SetLogger", l)
+	}
+	Log(LogError, "nobody listens") // Must not panic
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(nil)
+
+	var got []recordedLog
+	SetLogger(LoggerFunc(func(level LogLevel, msg string, keyvals ...interface{}) {
+		got = append(got, recordedLog{level, msg, keyvals})
+	}))
+	Log(LogWarn, "target dropped", "index", 2, "error", fmt.Errorf("gone"))
+	Log(LogDebug, "no context")
+	if len(got) != 2 {
+		t.Fatalf("logged %d messages, want 2", len(got))
+	}
+	if got[0].level != LogWarn || got[0].msg != "target dropped" || fmt.Sprint(got[0].keyvals) != "[index 2 error gone]" {
+		t.Errorf("first message = %+v", got[0])
+	}
+	if got[1].level != LogDebug || len(got[1].keyvals) != 0 {
+		t.Errorf("second message = %+v, want no key/values", got[1])
+	}
+
+	// Another logger replaces the first one; nil silences the library again
+	var replaced int
+	SetLogger(LoggerFunc(func(LogLevel, string, ...interface{}) { replaced++ }))
+	Log(LogInfo, "bus connected")
+	SetLogger(nil)
+	Log(LogInfo, "bus disconnected")
+	if len(got) != 2 || replaced != 1 || GetLogger() != nil {
+		t.Errorf("messages after replacing the logger: %d to the first, %d to the second", len(got)-2, replaced)
+	}
+}
+
+func TestSetLoggerConcurrently(t *testing.T) {
+	defer SetLogger(nil)
+
+	// Swapping the logger while messages are logged is safe, and each message reaches one logger
+	var mu sync.Mutex
+	count := 0
+	logger := LoggerFunc(func(LogLevel, string, ...interface{}) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetLogger(logger)
+				SetLogger(nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Log(LogInfo, "message")
+			}
+		}()
+	}
+	wg.Wait()
+	if count > 400 {
+		t.Errorf("%d messages logged out of 400", count)
+	}
+}
+
+func TestLogLevelString(t *testing.T) {
+	for level, want := range map[LogLevel]string{
+		LogDebug:     "debug",
+		LogInfo:      "info",
+		LogWarn:      "warn",
+		LogError:     "error",
+		LogLevel(-1): "LogLevel(-1)",
+		LogError + 1: "LogLevel(4)",
+	} {
+		if got := level.String(); got != want {
+			t.Errorf("LogLevel(%d).String() = %q, want %q", int(level), got, want)
+		}
+	}
+	// Levels are ordered by severity, so that loggers can filter them
+	if !(LogDebug < LogInfo && LogInfo < LogWarn && LogWarn < LogError) {
+		t.Error("levels are not ordered by severity")
+	}
+}
@@ -0,0 +1,127 @@
+package commons
+
+import (
+	"math"
+)
+
+// xusbDS4Buttons maps the XUSB buttons to the DS4 buttons at the same position
+// (D-pad and guide excluded, they are not DS4Button bits)
+var xusbDS4Buttons = [...]struct {
+	xusb XUSBButton
+	ds4  DS4Button
+}{
+	{XUSB_GAMEPAD_A, DS4_BUTTON_CROSS},
+	{XUSB_GAMEPAD_B, DS4_BUTTON_CIRCLE},
+	{XUSB_GAMEPAD_X, DS4_BUTTON_SQUARE},
+	{XUSB_GAMEPAD_Y, DS4_BUTTON_TRIANGLE},
+	{XUSB_GAMEPAD_LEFT_SHOULDER, DS4_BUTTON_SHOULDER_LEFT},
+	{XUSB_GAMEPAD_RIGHT_SHOULDER, DS4_BUTTON_SHOULDER_RIGHT},
+	{XUSB_GAMEPAD_LEFT_THUMB, DS4_BUTTON_THUMB_LEFT},
+	{XUSB_GAMEPAD_RIGHT_THUMB, DS4_BUTTON_THUMB_RIGHT},
+	{XUSB_GAMEPAD_START, DS4_BUTTON_OPTIONS},
+	{XUSB_GAMEPAD_BACK, DS4_BUTTON_SHARE},
+}
+
+// XUSBToDS4Buttons returns the DS4 buttons, special buttons and directional pad
+// value matching XUSB buttons (A is Cross, Back is Share, Guide is PS, etc.)
+func XUSBToDS4Buttons(buttons XUSBButton) (DS4Button, DS4SpecialButton, DS4DPadDirection) {
+	var ds4 DS4Button
+	var special DS4SpecialButton
+	for _, m := range xusbDS4Buttons {
+		if buttons&m.xusb != 0 {
+			ds4 |= m.ds4
+		}
+	}
+	if buttons&XUSB_GAMEPAD_GUIDE != 0 {
+		special |= DS4_SPECIAL_BUTTON_PS
+	}
+	return ds4, special, XUSBToDS4DPad(buttons)
+}
+
+// DS4ToXUSBButtons returns the XUSB buttons matching DS4 buttons, special buttons and
+// directional pad value. The touchpad button and the digital trigger bits have no XUSB equivalent.
+func DS4ToXUSBButtons(buttons DS4Button, special DS4SpecialButton, dpad DS4DPadDirection) XUSBButton {
+	var xusb XUSBButton
+	for _, m := range xusbDS4Buttons {
+		if buttons&m.ds4 != 0 {
+			xusb |= m.xusb
+		}
+	}
+	if special&DS4_SPECIAL_BUTTON_PS != 0 {
+		xusb |= XUSB_GAMEPAD_GUIDE
+	}
+	return xusb | DS4DPadToXUSB(dpad)
+}
+
+// XUSBAxisToDS4 converts a joystick axis from XUSB (-32768 to 32767, 0 = neutral)
+// to DS4 (0 to 255, 128 = neutral) without changing its direction
+func XUSBAxisToDS4(value int16) uint8 {
+	return xusbAxisToDS4(float64(value))
+}
+
+// DS4AxisToXUSB converts a joystick axis from DS4 (0 to 255, 128 = neutral)
+// to XUSB (-32768 to 32767, 0 = neutral) without changing its direction
+func DS4AxisToXUSB(value uint8) int16 {
+	return ds4AxisToXUSB(float64(value) - 128)
+}
+
+// xusbAxisToDS4 converts an XUSB axis value, given as a float so it can be negated without overflow
+func xusbAxisToDS4(value float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, 128+math.Round(value/32767*127))))
+}
+
+// ds4AxisToXUSB converts a DS4 axis value minus 128, given as a float so it can be negated around the neutral position
+func ds4AxisToXUSB(value float64) int16 {
+	return int16(math.Max(-32768, math.Min(32767, math.Round(value/127*32767))))
+}
+
+// XUSBToDS4 converts an XUSB report into the equivalent DS4 report.
+// Y axes are flipped, as XUSB Y points up while DS4 Y points down, and the digital
+// trigger bits (DS4_BUTTON_TRIGGER_LEFT/RIGHT) are set when the triggers are pressed.
+func XUSBToDS4(report XUSBReport) DS4Report {
+	buttons, special, dpad := XUSBToDS4Buttons(XUSBButton(report.WButtons))
+	if report.BLeftTrigger > 0 {
+		buttons |= DS4_BUTTON_TRIGGER_LEFT
+	}
+	if report.BRightTrigger > 0 {
+		buttons |= DS4_BUTTON_TRIGGER_RIGHT
+	}
+
+	ds4 := DS4Report{
+		BThumbLX:  XUSBAxisToDS4(report.SThumbLX),
+		BThumbLY:  xusbAxisToDS4(-float64(report.SThumbLY)),
+		BThumbRX:  XUSBAxisToDS4(report.SThumbRX),
+		BThumbRY:  xusbAxisToDS4(-float64(report.SThumbRY)),
+		WButtons:  uint16(buttons),
+		BSpecial:  uint8(special),
+		BTriggerL: report.BLeftTrigger,
+		BTriggerR: report.BRightTrigger,
+	}
+	DS4SetDPad(&ds4, dpad)
+	return ds4
+}
+
+// DS4ToXUSB converts a DS4 report into the equivalent XUSB report.
+// Y axes are flipped, as DS4 Y points down while XUSB Y points up, and a trigger whose
+// digital bit is set with an analog value of 0 is reported fully pressed.
+func DS4ToXUSB(report DS4Report) XUSBReport {
+	buttons := DS4Button(report.WButtons &^ 0xF)
+	dpad := DS4DPadDirection(report.WButtons & 0xF)
+
+	xusb := XUSBReport{
+		WButtons:      uint16(DS4ToXUSBButtons(buttons, DS4SpecialButton(report.BSpecial), dpad)),
+		BLeftTrigger:  report.BTriggerL,
+		BRightTrigger: report.BTriggerR,
+		SThumbLX:      DS4AxisToXUSB(report.BThumbLX),
+		SThumbLY:      ds4AxisToXUSB(128 - float64(report.BThumbLY)),
+		SThumbRX:      DS4AxisToXUSB(report.BThumbRX),
+		SThumbRY:      ds4AxisToXUSB(128 - float64(report.BThumbRY)),
+	}
+	if buttons&DS4_BUTTON_TRIGGER_LEFT != 0 && xusb.BLeftTrigger == 0 {
+		xusb.BLeftTrigger = 255
+	}
+	if buttons&DS4_BUTTON_TRIGGER_RIGHT != 0 && xusb.BRightTrigger == 0 {
+		xusb.BRightTrigger = 255
+	}
+	return xusb
+}
@@ -0,0 +1,147 @@
+package commons
+
+import "testing"
+
+func TestButtonTranslationIsOneToOne(t *testing.T) {
+	// Every XUSB button outside of the D-pad has exactly one DS4 counterpart, which translates back to it
+	for bit := XUSBButton(1 << 4); bit != 0; bit <<= 1 {
+		ds4, special, dpad := XUSBToDS4Buttons(bit)
+		if dpad != DS4_BUTTON_DPAD_NONE {
+			t.Errorf("XUSB button %#x moved the D-pad to %v", bit, dpad)
+		}
+		if bit == 0x0800 { // Unused by XUSB
+			if ds4 != 0 || special != 0 {
+				t.Errorf("unused XUSB bit 0x0800 = %#x, %#x, want nothing", ds4, special)
+			}
+			continue
+		}
+		if n := bitCount(uint16(ds4)) + bitCount(uint16(special)); n != 1 {
+			t.Errorf("XUSB button %#x = %#x, %#x, want a single DS4 button", bit, ds4, special)
+		}
+		if back := DS4ToXUSBButtons(ds4, special, DS4_BUTTON_DPAD_NONE); back != bit {
+			t.Errorf("XUSB button %#x came back as %#x", bit, back)
+		}
+	}
+
+	// The DS4 buttons without an XUSB counterpart
+	if xusb := DS4ToXUSBButtons(DS4_BUTTON_TRIGGER_LEFT|DS4_BUTTON_TRIGGER_RIGHT, DS4_SPECIAL_BUTTON_TOUCHPAD, DS4_BUTTON_DPAD_NONE); xusb != 0 {
+		t.Errorf("trigger bits and touchpad = %#x, want no XUSB button", xusb)
+	}
+}
+
+// bitCount returns the number of bits set in v
+func bitCount(v uint16) int {
+	n := 0
+	for ; v != 0; v &= v - 1 {
+		n++
+	}
+	return n
+}
+
+func TestDPadTranslation(t *testing.T) {
+	// All 16 combinations of the 4 XUSB directions
+	for held := XUSBButton(0); held <= XUSB_GAMEPAD_DPAD; held++ {
+		dpad := XUSBToDS4DPad(held | XUSB_GAMEPAD_A)
+		back := DS4DPadToXUSB(dpad)
+
+		// Opposite directions cannot be represented by the hat and cancel each other out
+		want := held
+		if want&(XUSB_GAMEPAD_DPAD_UP|XUSB_GAMEPAD_DPAD_DOWN) == XUSB_GAMEPAD_DPAD_UP|XUSB_GAMEPAD_DPAD_DOWN {
+			want &^= XUSB_GAMEPAD_DPAD_UP | XUSB_GAMEPAD_DPAD_DOWN
+		}
+		if want&(XUSB_GAMEPAD_DPAD_LEFT|XUSB_GAMEPAD_DPAD_RIGHT) == XUSB_GAMEPAD_DPAD_LEFT|XUSB_GAMEPAD_DPAD_RIGHT {
+			want &^= XUSB_GAMEPAD_DPAD_LEFT | XUSB_GAMEPAD_DPAD_RIGHT
+		}
+		if back != want {
+			t.Errorf("D-pad %#x -> %v -> %#x, want %#x", held, dpad, back, want)
+		}
+	}
+
+	// And every hat position survives the trip through XUSB
+	for dpad := DS4_BUTTON_DPAD_NORTH; dpad <= DS4_BUTTON_DPAD_NONE; dpad++ {
+		if back := XUSBToDS4DPad(DS4DPadToXUSB(dpad)); back != dpad {
+			t.Errorf("hat %v came back as %v", dpad, back)
+		}
+	}
+}
+
+func TestAxisTranslation(t *testing.T) {
+	// Monotonic over the whole XUSB range, and centered
+	previous := XUSBAxisToDS4(-32768)
+	for v := -32767; v <= 32767; v++ {
+		got := XUSBAxisToDS4(int16(v))
+		if got < previous {
+			t.Fatalf("XUSBAxisToDS4(%d) = %d, below XUSBAxisToDS4(%d) = %d", v, got, v-1, previous)
+		}
+		previous = got
+	}
+	if XUSBAxisToDS4(0) != 128 || XUSBAxisToDS4(32767) != 255 || XUSBAxisToDS4(-32768) != 1 {
+		t.Errorf("XUSBAxisToDS4 of 0, 32767, -32768 = %d, %d, %d, want 128, 255, 1",
+			XUSBAxisToDS4(0), XUSBAxisToDS4(32767), XUSBAxisToDS4(-32768))
+	}
+
+	// Every DS4 value survives the trip through XUSB, except 0, one step past the symmetric range
+	for v := 1; v <= 255; v++ {
+		if back := XUSBAxisToDS4(DS4AxisToXUSB(uint8(v))); back != uint8(v) {
+			t.Errorf("DS4 axis %d came back as %d", v, back)
+		}
+	}
+	if got := DS4AxisToXUSB(0); got != -32768 {
+		t.Errorf("DS4AxisToXUSB(0) = %d, want -32768", got)
+	}
+}
+
+func TestReportTranslationFlipsY(t *testing.T) {
+	// -32768 cannot be negated as an int16: the flip must not overflow
+	ds4 := XUSBToDS4(XUSBReport{SThumbLY: -32768, SThumbRY: 32767})
+	if ds4.BThumbLY != 255 || ds4.BThumbRY != 1 || ds4.BThumbLX != 128 {
+		t.Errorf("XUSB down/up = DS4 %d/%d (X %d), want 255/1 (X 128)", ds4.BThumbLY, ds4.BThumbRY, ds4.BThumbLX)
+	}
+
+	for v := 1; v <= 255; v++ {
+		var in DS4Report
+		DS4ReportInit(&in)
+		in.BThumbLY, in.BThumbRX = uint8(v), uint8(v)
+		out := XUSBToDS4(DS4ToXUSB(in))
+		if out.BThumbLY != uint8(v) || out.BThumbRX != uint8(v) {
+			t.Errorf("DS4 Y/X %d came back as %d/%d", v, out.BThumbLY, out.BThumbRX)
+		}
+	}
+}
+
+func TestReportTranslationTriggers(t *testing.T) {
+	ds4 := XUSBToDS4(XUSBReport{BLeftTrigger: 1})
+	if ds4.WButtons&uint16(DS4_BUTTON_TRIGGER_LEFT) == 0 || ds4.WButtons&uint16(DS4_BUTTON_TRIGGER_RIGHT) != 0 {
+		t.Errorf("XUSB left trigger at 1 = DS4 buttons %#x, want only the left trigger bit", ds4.WButtons&^0xF)
+	}
+	if ds4.BTriggerL != 1 {
+		t.Errorf("BTriggerL = %d, want 1", ds4.BTriggerL)
+	}
+
+	var in DS4Report
+	DS4ReportInit(&in)
+	in.WButtons |= uint16(DS4_BUTTON_TRIGGER_LEFT | DS4_BUTTON_TRIGGER_RIGHT)
+	in.BTriggerR = 30
+	xusb := DS4ToXUSB(in)
+	// A digital bit without an analog value is a full press; with one, the analog value wins
+	if xusb.BLeftTrigger != 255 || xusb.BRightTrigger != 30 {
+		t.Errorf("DS4 trigger bits with 0 and 30 = XUSB %d, %d, want 255, 30", xusb.BLeftTrigger, xusb.BRightTrigger)
+	}
+	if xusb.WButtons != 0 {
+		t.Errorf("trigger bits leaked into the XUSB buttons: %#x", xusb.WButtons)
+	}
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	in := XUSBReport{
+		WButtons:      uint16(XUSB_GAMEPAD_X | XUSB_GAMEPAD_BACK | XUSB_GAMEPAD_GUIDE | XUSB_GAMEPAD_DPAD_DOWN | XUSB_GAMEPAD_DPAD_RIGHT),
+		BLeftTrigger:  128,
+		BRightTrigger: 255,
+		SThumbLX:      32767,
+		SThumbLY:      -32767,
+		SThumbRY:      32767,
+	}
+	if out := DS4ToXUSB(XUSBToDS4(in)); out != in {
+		t.Errorf("DS4ToXUSB(XUSBToDS4(%+v)) = %+v", in, out)
+	}
+}
@@ -0,0 +1,31 @@
+package vgamepad
+
+// AxisConvention selects the direction of the Y axis of float joystick values
+// (LeftJoystickFloat, MoveLeftJoystickTo, GetLeftJoystickFloat...)
+type AxisConvention int
+
+const (
+	// AxisNormalized is the default convention, shared by all gamepad types:
+	// X and Y go from -1.0 to 1.0 and point right and up, like paths
+	AxisNormalized AxisConvention = iota
+
+	// AxisRaw follows the report of each gamepad type: Y points up on Xbox 360
+	// (SThumbLY) but down on DualShock 4 (BThumbLY, 0 = top)
+	AxisRaw
+)
+
+// SetAxisConvention selects the direction of the Y axis of float joystick values
+func (g *BaseGamepad) SetAxisConvention(convention AxisConvention) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.axes = convention
+}
+
+// GetAxisConvention returns the direction of the Y axis of float joystick values
+func (g *BaseGamepad) GetAxisConvention() AxisConvention {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.axes
+}
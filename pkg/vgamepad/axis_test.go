@@ -0,0 +1,85 @@
+package vgamepad
+
+import (
+	"math"
+	"testing"
+)
+
+// approx reports whether two floats are equal within rounding errors
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAxisConversionSymmetry(t *testing.T) {
+	// Both report types are symmetric around neutral, so that -v is exactly as far as v
+	for i := 0; i <= 1000; i++ {
+		v := float64(i) / 1000
+		if a, b := x360AxisFromFloat(v), x360AxisFromFloat(-v); a != -b {
+			t.Fatalf("x360 axis of %v = %d, of %v = %d", v, a, -v, b)
+		}
+		if a, b := ds4AxisFromFloat(v), ds4AxisFromFloat(-v); int(a)-128 != 128-int(b) {
+			t.Fatalf("ds4 axis of %v = %d, of %v = %d", v, a, -v, b)
+		}
+	}
+
+	// The one raw value outside of the symmetric range reads as the edge
+	if v := x360AxisToFloat(-32768); v != -1 {
+		t.Errorf("x360AxisToFloat(-32768) = %v, want -1", v)
+	}
+	if v := ds4AxisToFloat(0); v != -1 {
+		t.Errorf("ds4AxisToFloat(0) = %v, want -1", v)
+	}
+}
+
+func TestRawAxisRoundTrip(t *testing.T) {
+	for v := -32767; v <= 32767; v++ {
+		if got := x360AxisFromFloat(x360AxisToFloat(int16(v))); got != int16(v) {
+			t.Fatalf("x360 round trip of %d = %d", v, got)
+		}
+	}
+	for v := 1; v <= 255; v++ {
+		if got := ds4AxisFromFloat(ds4AxisToFloat(uint8(v))); got != uint8(v) {
+			t.Fatalf("ds4 round trip of %d = %d", v, got)
+		}
+	}
+	for v := 0; v <= 255; v++ {
+		if got := triggerFromFloat(triggerToFloat(uint8(v))); got != uint8(v) {
+			t.Fatalf("trigger round trip of %d = %d", v, got)
+		}
+	}
+}
+
+func TestYAxisPointsUpOnBothTypes(t *testing.T) {
+	x := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	d := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+
+	x.LeftJoystickFloat(0, 0.75)
+	d.LeftJoystickFloat(0, 0.75)
+	// Up is positive on Xbox 360 but the top (low values) on DualShock 4
+	if x.report.SThumbLY <= 0 || d.report.BThumbLY >= 128 {
+		t.Errorf("Y = 0.75 gave x360 %d and ds4 %d, want both pointing up", x.report.SThumbLY, d.report.BThumbLY)
+	}
+
+	// Reading back gives the value that was set, within one step, whatever the convention
+	for _, convention := range []AxisConvention{AxisNormalized, AxisRaw} {
+		d.SetAxisConvention(convention)
+		for _, y := range []float64{-1, -0.3, 0, 0.6, 1} {
+			d.RightJoystickFloat(0.2, y)
+			if gx, gy := d.GetRightJoystickFloat(); math.Abs(gx-0.2) > 1.0/127 || math.Abs(gy-y) > 1.0/127 {
+				t.Errorf("convention %d: GetRightJoystickFloat() after (0.2, %v) = %v, %v", convention, y, gx, gy)
+			}
+		}
+	}
+
+	// The raw convention is the DS4 report as is: Y points down
+	d.LeftJoystickFloat(0, 1)
+	if d.report.BThumbLY != 255 {
+		t.Errorf("Y = 1 with AxisRaw = %d, want 255 (bottom)", d.report.BThumbLY)
+	}
+	// Xbox 360 reports already point up: the convention changes nothing
+	x.SetAxisConvention(AxisRaw)
+	x.LeftJoystickFloat(0, 1)
+	if x.report.SThumbLY != 32767 {
+		t.Errorf("x360 Y = 1 with AxisRaw = %d, want 32767", x.report.SThumbLY)
+	}
+}
@@ -0,0 +1,362 @@
+package vgamepad
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// PadType is the type of a virtual gamepad in a configuration file
+type PadType string
+
+const (
+	PadX360 PadType = "x360" // VX360Gamepad
+	PadDS4  PadType = "ds4"  // VDS4Gamepad
+)
+
+// Config declares virtual gamepads and how they are set up
+type Config struct {
+	Pads []PadConfig `json:"pads"`
+}
+
+// PadConfig declares a group of identical virtual gamepads
+type PadConfig struct {
+	Name  string  `json:"name"`            // Identifies the group across reloads
+	Type  PadType `json:"type"`            // Type of the gamepads
+	VID   uint16  `json:"vid,omitempty"`   // Vendor ID, 0 keeps the default
+	PID   uint16  `json:"pid,omitempty"`   // Product ID, 0 keeps the default
+	Count int     `json:"count,omitempty"` // Number of gamepads, 0 means 1
+
+	LeftJoystick  StickProcessing   `json:"left_joystick"`
+	RightJoystick StickProcessing   `json:"right_joystick"`
+	LeftTrigger   TriggerProcessing `json:"left_trigger"`
+	RightTrigger  TriggerProcessing `json:"right_trigger"`
+	Curves        map[Axis]Curve    `json:"curves,omitempty"`
+	Profile       Profile           `json:"profile"` // Remapping profile
+}
+
+// count returns the number of gamepads of the group
+func (p PadConfig) count() int {
+	if p.Count == 0 {
+		return 1
+	}
+	return p.Count
+}
+
+// LoadConfig reads a JSON configuration from a file
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate returns an error if the configuration is not usable
+func (c Config) Validate() error {
+	names := make(map[string]bool)
+	for i, p := range c.Pads {
+		if p.Name == "" {
+			return fmt.Errorf("pad %d has no name", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate pad name %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.Type != PadX360 && p.Type != PadDS4 {
+			return fmt.Errorf("pad %q: unknown type %q", p.Name, p.Type)
+		}
+		if p.Count < 0 {
+			return fmt.Errorf("pad %q: invalid count %d", p.Name, p.Count)
+		}
+		for axis, curve := range p.Curves {
+			if axis < 0 || axis >= axisCount {
+				return fmt.Errorf("pad %q: invalid axis %d", p.Name, int(axis))
+			}
+			if err := curve.Validate(); err != nil {
+				return fmt.Errorf("pad %q: %v curve: %w", p.Name, axis, err)
+			}
+		}
+		if err := p.Profile.Validate(); err != nil {
+			return fmt.Errorf("pad %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// configurablePad is a gamepad that can be set up from a PadConfig
+type configurablePad interface {
+	Controller
+	SetLeftJoystickProcessing(p StickProcessing)
+	SetRightJoystickProcessing(p StickProcessing)
+	SetLeftTriggerProcessing(p TriggerProcessing)
+	SetRightTriggerProcessing(p TriggerProcessing)
+	SetCurve(axis Axis, curve Curve) error
+}
+
+// loadedPad is a gamepad created by a Loader
+type loadedPad struct {
+	gamepad  configurablePad
+	remapper *Remapper
+}
+
+// Loader creates the virtual gamepads declared in a configuration file, and
+// reapplies the file when it changes
+type Loader struct {
+	path string
+
+	mu      sync.Mutex
+	config  Config
+	pads    map[string][]*loadedPad
+	modTime time.Time
+	stop    chan struct{} // Closed to stop watching, nil if not watching
+	closed  bool
+}
+
+// NewLoader loads a configuration file and creates its gamepads on the bus
+func NewLoader(path string) (*Loader, error) {
+	l := &Loader{path: path, pads: make(map[string][]*loadedPad)}
+	if err := l.Reload(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Pads returns the gamepads of a group, behind the remapping profile of the group.
+// Gamepads are created again when their type or identity changes, so call Pads again after a reload.
+func (l *Loader) Pads(name string) []Controller {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var controllers []Controller
+	for _, pad := range l.pads[name] {
+		controllers = append(controllers, pad.remapper)
+	}
+	return controllers
+}
+
+// Config returns the configuration currently applied
+func (l *Loader) Config() Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.config
+}
+
+// Reload reads the configuration file again and applies it: gamepads are added or removed
+// to match the counts, created again if their type or identity changed, and their settings
+// are updated in place otherwise. The new configuration is applied only if every gamepad
+// could be created and configured; otherwise the current one is kept.
+func (l *Loader) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return fmt.Errorf("the loader is closed")
+	}
+	var modTime time.Time
+	if info, err := os.Stat(l.path); err == nil {
+		modTime = info.ModTime()
+	}
+	config, err := LoadConfig(l.path)
+	if err != nil {
+		// Watch retries once the file changes
+		l.modTime = modTime
+		return err
+	}
+
+	previous := make(map[string]PadConfig)
+	for _, p := range l.config.Pads {
+		previous[p.Name] = p
+	}
+
+	// Build the new set of gamepads, keeping the current ones where possible
+	pads := make(map[string][]*loadedPad)
+	created := make(map[*loadedPad]bool)
+	var undo []func() // Closes the created gamepads and restores the settings of the kept ones
+	fail := func(err error) error {
+		for _, f := range undo {
+			f()
+		}
+		return err
+	}
+	for _, p := range config.Pads {
+		var group []*loadedPad
+		if old, ok := previous[p.Name]; ok && old.Type == p.Type && old.VID == p.VID && old.PID == p.PID {
+			group = append(group, l.pads[p.Name]...)
+		}
+		if len(group) > p.count() {
+			group = group[:p.count()]
+		}
+		for len(group) < p.count() {
+			pad, err := newLoadedPad(p)
+			if err != nil {
+				return fail(fmt.Errorf("failed to create pad %q: %w", p.Name, err))
+			}
+			created[pad] = true
+			undo = append(undo, pad.gamepad.Close)
+			group = append(group, pad)
+		}
+		pads[p.Name] = group
+	}
+	for _, p := range config.Pads {
+		for _, pad := range pads[p.Name] {
+			if !created[pad] {
+				pad, old := pad, previous[p.Name]
+				undo = append(undo, func() { pad.configure(old) })
+			}
+			if err := pad.configure(p); err != nil {
+				return fail(fmt.Errorf("failed to configure pad %q: %w", p.Name, err))
+			}
+		}
+	}
+
+	// Swap, closing the gamepads that are not kept
+	kept := make(map[*loadedPad]bool)
+	for _, group := range pads {
+		for _, pad := range group {
+			kept[pad] = true
+		}
+	}
+	for _, group := range l.pads {
+		for _, pad := range group {
+			if !kept[pad] {
+				pad.gamepad.Close()
+			}
+		}
+	}
+	l.pads = pads
+	l.config = config
+	l.modTime = modTime
+	return nil
+}
+
+// closePads closes the gamepads of a group and forgets the group (l.mu must be held)
+func (l *Loader) closePads(name string) {
+	for _, pad := range l.pads[name] {
+		pad.gamepad.Close()
+	}
+	delete(l.pads, name)
+}
+
+// newGamepad creates a gamepad of the given type and identity (0 keeps the default IDs)
+func newGamepad(padType PadType, vid, pid uint16) (configurablePad, error) {
+	switch padType {
+	case PadX360:
+		gamepad, err := newVX360Gamepad(vid, pid)
+		if err != nil {
+			return nil, err
+		}
+		return gamepad, nil
+	case PadDS4:
+		gamepad, err := newVDS4Gamepad(vid, pid)
+		if err != nil {
+			return nil, err
+		}
+		return gamepad, nil
+	}
+	return nil, fmt.Errorf("unknown pad type %q", padType)
+}
+
+// newLoadedPad creates a gamepad of a group
+func newLoadedPad(config PadConfig) (*loadedPad, error) {
+	gamepad, err := newGamepad(config.Type, config.VID, config.PID)
+	if err != nil {
+		return nil, err
+	}
+	return &loadedPad{gamepad: gamepad, remapper: &Remapper{Controller: gamepad}}, nil
+}
+
+// configure applies the settings of a group to a gamepad
+func (p *loadedPad) configure(config PadConfig) error {
+	p.gamepad.SetLeftJoystickProcessing(config.LeftJoystick)
+	p.gamepad.SetRightJoystickProcessing(config.RightJoystick)
+	p.gamepad.SetLeftTriggerProcessing(config.LeftTrigger)
+	p.gamepad.SetRightTriggerProcessing(config.RightTrigger)
+	for axis := Axis(0); axis < axisCount; axis++ {
+		if err := p.gamepad.SetCurve(axis, config.Curves[axis]); err != nil {
+			return err
+		}
+	}
+	return p.remapper.SetProfile(config.Profile)
+}
+
+// DefaultWatchInterval is the interval used by Watch when none is given
+const DefaultWatchInterval = time.Second
+
+// Watch checks the configuration file every interval (DefaultWatchInterval if 0 or less), and reloads
+// it when it is modified, until Close is called. onReload, if not nil, is called with the result of each reload.
+func (l *Loader) Watch(interval time.Duration, onReload func(err error)) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil || l.closed {
+		return
+	}
+	stop := make(chan struct{})
+	l.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(l.path)
+			if err != nil {
+				continue
+			}
+			l.mu.Lock()
+			modified := !info.ModTime().Equal(l.modTime)
+			l.mu.Unlock()
+			if !modified {
+				continue
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			err = l.Reload()
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}()
+}
+
+// Close stops watching the configuration file and closes all the gamepads
+func (l *Loader) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	for name := range l.pads {
+		l.closePads(name)
+	}
+}
@@ -0,0 +1,128 @@
+package vgamepad
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pads.json")
+	os.WriteFile(path, []byte(`{
+		"pads": [
+			{
+				"name": "players", "type": "ds4", "count": 2, "vid": 1356,
+				"left_joystick": {"deadzone": 0.1, "shape": "axial", "snap": "8-way"},
+				"curves": {"right_trigger": {"type": "exponential", "exponent": 3}},
+				"profile": {"buttons": {"south": "east"}}
+			},
+			{"name": "bot", "type": "x360"}
+		]
+	}`), 0o644)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	players, bot := config.Pads[0], config.Pads[1]
+	if players.count() != 2 || bot.count() != 1 {
+		t.Errorf("counts = %d, %d, want 2 and the default 1", players.count(), bot.count())
+	}
+	if players.VID != 1356 || players.PID != 0 {
+		t.Errorf("IDs = %#x, %#x", players.VID, players.PID)
+	}
+	if p := players.LeftJoystick; p.Shape != DeadzoneAxial || p.Snap != Snap8Way || p.Deadzone != 0.1 {
+		t.Errorf("left joystick = %+v", p)
+	}
+	if c := players.Curves[AxisRightTrigger]; c.Type != CurveExponential || c.Exponent != 3 {
+		t.Errorf("right trigger curve = %+v", c)
+	}
+	if players.Profile.Buttons[ButtonSouth] != ButtonEast {
+		t.Errorf("profile = %+v", players.Profile)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pads.json")
+	for reason, data := range map[string]string{
+		"pad 1 has no name":                                  `{"pads": [{"name": "a", "type": "x360"}, {"type": "x360"}]}`,
+		`duplicate pad name "a"`:                             `{"pads": [{"name": "a", "type": "x360"}, {"name": "a", "type": "ds4"}]}`,
+		`pad "a": unknown type "ps5"`:                        `{"pads": [{"name": "a", "type": "ps5"}]}`,
+		`pad "a": invalid count -2`:                          `{"pads": [{"name": "a", "type": "x360", "count": -2}]}`,
+		`pad "a": left_y curve: unknown curve type`:          `{"pads": [{"name": "a", "type": "x360", "curves": {"left_y": {"type": "cubic"}}}]}`,
+		`pad "a": layer 1: modifier must be a single button`: `{"pads": [{"name": "a", "type": "x360", "profile": {"layers": [{"modifier": "south"}, {"modifier": "none"}]}}]}`,
+		"failed to parse config " + path:                     `{"pads": [{"name": "a", "type": "x360", "curves": {"left_z": {}}}]}`,
+		"failed to parse config " + path + ": unexp":         `{"pads": `,
+	} {
+		os.WriteFile(path, []byte(data), 0o644)
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("LoadConfig(%s) = %v, want an error about %q", data, err, reason)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pads.json")
+	os.WriteFile(path, []byte(`{"pads": []}`), 0o644)
+	l, err := NewLoader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A non-positive interval falls back to the default instead of failing
+	reloads := make(chan error, 10)
+	l.Watch(0, func(err error) { reloads <- err })
+	l.Watch(time.Millisecond, nil) // Already watching: ignored
+
+	// write changes the file, moving its modification time forward so that the change is noticed
+	modTime := time.Now()
+	write := func(data string) {
+		os.WriteFile(path, []byte(data), 0o644)
+		modTime = modTime.Add(time.Minute)
+		os.Chtimes(path, modTime, modTime)
+	}
+	wait := func() error {
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(3 * DefaultWatchInterval):
+			t.Fatal("the file change was not noticed")
+			return nil
+		}
+	}
+
+	// An invalid file is reported once, and the applied configuration is kept
+	write(`{"pads": [{"name": "a"}]}`)
+	if err := wait(); err == nil {
+		t.Error("invalid file reloaded without error")
+	}
+	if c := l.Config(); len(c.Pads) != 0 {
+		t.Errorf("Config() = %+v after an invalid reload", c)
+	}
+	select {
+	case err := <-reloads:
+		t.Errorf("unchanged invalid file reloaded again: %v", err)
+	case <-time.After(DefaultWatchInterval + DefaultWatchInterval/2):
+	}
+
+	// Fixing the file applies it
+	write(`{"pads": [] }`)
+	if err := wait(); err != nil {
+		t.Errorf("valid file = %v", err)
+	}
+
+	// Once closed, nothing is reloaded any more
+	l.Close()
+	if err := l.Reload(); err == nil {
+		t.Error("Reload() after Close succeeded")
+	}
+	write(`{"pads": []}`)
+	select {
+	case err := <-reloads:
+		t.Errorf("reloaded after Close: %v", err)
+	case <-time.After(DefaultWatchInterval + DefaultWatchInterval/2):
+	}
+}
@@ -0,0 +1,205 @@
+package vgamepad
+
+import (
+	"fmt"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// Button is a button of the standard gamepad layout, shared by all gamepad types.
+// Face buttons are named after their position, so they mean the same on every controller.
+type Button uint16
+
+const (
+	ButtonSouth       Button = 1 << iota // A / Cross
+	ButtonEast                           // B / Circle
+	ButtonWest                           // X / Square
+	ButtonNorth                          // Y / Triangle
+	ButtonLeftBumper                     // LB / L1
+	ButtonRightBumper                    // RB / R1
+	ButtonLeftStick                      // Left stick click (LS / L3)
+	ButtonRightStick                     // Right stick click (RS / R3)
+	ButtonStart                          // Start / Options
+	ButtonSelect                         // Back / Share
+	ButtonHome                           // Guide / PS
+)
+
+// standardButtons lists every standard button, in bit order
+var standardButtons = [...]Button{
+	ButtonSouth, ButtonEast, ButtonWest, ButtonNorth,
+	ButtonLeftBumper, ButtonRightBumper, ButtonLeftStick, ButtonRightStick,
+	ButtonStart, ButtonSelect, ButtonHome,
+}
+
+// buttonNames are the names of the standard buttons in text and JSON
+var buttonNames = map[Button]string{
+	ButtonSouth:       "south",
+	ButtonEast:        "east",
+	ButtonWest:        "west",
+	ButtonNorth:       "north",
+	ButtonLeftBumper:  "left_bumper",
+	ButtonRightBumper: "right_bumper",
+	ButtonLeftStick:   "left_stick",
+	ButtonRightStick:  "right_stick",
+	ButtonStart:       "start",
+	ButtonSelect:      "select",
+	ButtonHome:        "home",
+}
+
+// String returns the name of the button, e.g. "south", or "none" for no button
+func (b Button) String() string {
+	if b == 0 {
+		return "none"
+	}
+	if name, ok := buttonNames[b]; ok {
+		return name
+	}
+	return fmt.Sprintf("Button(%#x)", uint16(b))
+}
+
+// MarshalText implements encoding.TextMarshaler, so that single buttons can be used in JSON
+func (b Button) MarshalText() ([]byte, error) {
+	if _, ok := buttonNames[b]; !ok && b != 0 {
+		return nil, fmt.Errorf("invalid button %#x", uint16(b))
+	}
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (b *Button) UnmarshalText(text []byte) error {
+	if string(text) == "none" {
+		*b = 0
+		return nil
+	}
+	for button, name := range buttonNames {
+		if name == string(text) {
+			*b = button
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown button %q", text)
+}
+
+// x360Buttons maps the standard buttons to Xbox 360 buttons
+var x360Buttons = map[Button]commons.XUSBButton{
+	ButtonSouth:       commons.XUSB_GAMEPAD_A,
+	ButtonEast:        commons.XUSB_GAMEPAD_B,
+	ButtonWest:        commons.XUSB_GAMEPAD_X,
+	ButtonNorth:       commons.XUSB_GAMEPAD_Y,
+	ButtonLeftBumper:  commons.XUSB_GAMEPAD_LEFT_SHOULDER,
+	ButtonRightBumper: commons.XUSB_GAMEPAD_RIGHT_SHOULDER,
+	ButtonLeftStick:   commons.XUSB_GAMEPAD_LEFT_THUMB,
+	ButtonRightStick:  commons.XUSB_GAMEPAD_RIGHT_THUMB,
+	ButtonStart:       commons.XUSB_GAMEPAD_START,
+	ButtonSelect:      commons.XUSB_GAMEPAD_BACK,
+	ButtonHome:        commons.XUSB_GAMEPAD_GUIDE,
+}
+
+// ds4Buttons maps the standard buttons to DualShock 4 buttons (ButtonHome is the PS special button)
+var ds4Buttons = map[Button]commons.DS4Button{
+	ButtonSouth:       commons.DS4_BUTTON_CROSS,
+	ButtonEast:        commons.DS4_BUTTON_CIRCLE,
+	ButtonWest:        commons.DS4_BUTTON_SQUARE,
+	ButtonNorth:       commons.DS4_BUTTON_TRIANGLE,
+	ButtonLeftBumper:  commons.DS4_BUTTON_SHOULDER_LEFT,
+	ButtonRightBumper: commons.DS4_BUTTON_SHOULDER_RIGHT,
+	ButtonLeftStick:   commons.DS4_BUTTON_THUMB_LEFT,
+	ButtonRightStick:  commons.DS4_BUTTON_THUMB_RIGHT,
+	ButtonStart:       commons.DS4_BUTTON_OPTIONS,
+	ButtonSelect:      commons.DS4_BUTTON_SHARE,
+}
+
+// x360ButtonsOf returns the Xbox 360 buttons matching the standard buttons in button
+func x360ButtonsOf(button Button) commons.XUSBButton {
+	var buttons commons.XUSBButton
+	for _, b := range standardButtons {
+		if button&b != 0 {
+			buttons |= x360Buttons[b]
+		}
+	}
+	return buttons
+}
+
+// ds4ButtonsOf returns the DualShock 4 buttons and special buttons matching the standard buttons in button
+func ds4ButtonsOf(button Button) (commons.DS4Button, commons.DS4SpecialButton) {
+	var buttons commons.DS4Button
+	var special commons.DS4SpecialButton
+	for _, b := range standardButtons {
+		if button&b == 0 {
+			continue
+		}
+		if b == ButtonHome {
+			special |= commons.DS4_SPECIAL_BUTTON_PS
+		} else {
+			buttons |= ds4Buttons[b]
+		}
+	}
+	return buttons, special
+}
+
+// Controller is the input interface shared by all gamepad types, using the standard layout,
+// normalized float axes and a hat directional pad, so that code driving it does not depend
+// on the type of the virtual device
+type Controller interface {
+	Gamepad
+
+	// Press presses standard buttons (no effect if already pressed)
+	Press(button Button)
+
+	// Release releases standard buttons (no effect if already released)
+	Release(button Button)
+
+	// LeftTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the left trigger
+	LeftTriggerFloat(valueFloat float64)
+
+	// RightTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the right trigger
+	RightTriggerFloat(valueFloat float64)
+
+	// LeftJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the left joystick,
+	// Y pointing up with the default AxisNormalized convention
+	LeftJoystickFloat(xValueFloat, yValueFloat float64)
+
+	// RightJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the right joystick,
+	// Y pointing up with the default AxisNormalized convention
+	RightJoystickFloat(xValueFloat, yValueFloat float64)
+
+	// DirectionalPad sets the direction of the directional pad (hat)
+	DirectionalPad(direction commons.DS4DPadDirection)
+}
+
+var (
+	_ Controller = (*VX360Gamepad)(nil)
+	_ Controller = (*VDS4Gamepad)(nil)
+)
+
+// Press presses standard buttons (no effect if already pressed)
+func (g *VX360Gamepad) Press(button Button) {
+	g.PressButton(x360ButtonsOf(button))
+}
+
+// Release releases standard buttons (no effect if already released)
+func (g *VX360Gamepad) Release(button Button) {
+	g.ReleaseButton(x360ButtonsOf(button))
+}
+
+// Press presses standard buttons (no effect if already pressed)
+func (g *VDS4Gamepad) Press(button Button) {
+	buttons, special := ds4ButtonsOf(button)
+	if buttons != 0 {
+		g.PressButton(buttons)
+	}
+	if special != 0 {
+		g.PressSpecialButton(special)
+	}
+}
+
+// Release releases standard buttons (no effect if already released)
+func (g *VDS4Gamepad) Release(button Button) {
+	buttons, special := ds4ButtonsOf(button)
+	if buttons != 0 {
+		g.ReleaseButton(buttons)
+	}
+	if special != 0 {
+		g.ReleaseSpecialButton(special)
+	}
+}
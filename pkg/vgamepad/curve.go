@@ -0,0 +1,236 @@
+package vgamepad
+
+import (
+	"fmt"
+	"math"
+)
+
+// Axis identifies an analog axis of a gamepad
+type Axis int
+
+const (
+	AxisLeftX Axis = iota
+	AxisLeftY
+	AxisRightX
+	AxisRightY
+	AxisLeftTrigger
+	AxisRightTrigger
+)
+
+// axisCount is the number of axes
+const axisCount = 6
+
+// axisNames are the names of the axes in text and JSON
+var axisNames = [...]string{
+	AxisLeftX:        "left_x",
+	AxisLeftY:        "left_y",
+	AxisRightX:       "right_x",
+	AxisRightY:       "right_y",
+	AxisLeftTrigger:  "left_trigger",
+	AxisRightTrigger: "right_trigger",
+}
+
+// String returns the name of the axis, e.g. "left_x"
+func (a Axis) String() string {
+	if a < 0 || int(a) >= len(axisNames) {
+		return fmt.Sprintf("Axis(%d)", int(a))
+	}
+	return axisNames[a]
+}
+
+// MarshalText implements encoding.TextMarshaler, so that axes can be used as JSON keys
+func (a Axis) MarshalText() ([]byte, error) {
+	if a < 0 || int(a) >= len(axisNames) {
+		return nil, fmt.Errorf("invalid axis %d", int(a))
+	}
+	return []byte(axisNames[a]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (a *Axis) UnmarshalText(text []byte) error {
+	for i, name := range axisNames {
+		if name == string(text) {
+			*a = Axis(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown axis %q", text)
+}
+
+// CurveType selects the shape of a response curve
+type CurveType string
+
+const (
+	CurveLinear      CurveType = ""            // Output = input
+	CurveExponential CurveType = "exponential" // Output = input ^ Exponent
+	CurveSCurve      CurveType = "s-curve"     // Slow around the center and the edges, steepness set by Exponent
+	CurvePiecewise   CurveType = "piecewise"   // Linear interpolation between Points
+	CurveLUT         CurveType = "lut"         // Lookup table of 256 entries
+)
+
+// Curve is a response curve applied to an axis by the float setters.
+// For joysticks, the curve shapes the magnitude of each axis (0.0-1.0) and the sign is kept.
+// Curves are plain data, so they can be stored as JSON and tuned without code changes.
+type Curve struct {
+	Type CurveType `json:"type,omitempty"`
+
+	// Exponent of CurveExponential (e.g. 2 for a quadratic curve) and steepness of CurveSCurve, 0 means 2
+	Exponent float64 `json:"exponent,omitempty"`
+
+	// Control points of CurvePiecewise, as (input, output) pairs between 0.0 and 1.0, by increasing input.
+	// Inputs before the first point or after the last one get the output of that point.
+	Points []Point `json:"points,omitempty"`
+
+	// Lookup table of CurveLUT, on the DS4 scale: the entry for an input value is the output value,
+	// both between 0 and 255, with 128 as neutral for joystick axes (Y follows the axis convention)
+	Table []uint8 `json:"table,omitempty"`
+}
+
+// Validate returns an error if the curve is not usable
+func (c Curve) Validate() error {
+	switch c.Type {
+	case CurveLinear:
+	case CurveExponential, CurveSCurve:
+		if c.Exponent < 0 || math.IsNaN(c.Exponent) || math.IsInf(c.Exponent, 0) {
+			return fmt.Errorf("invalid exponent %v for %s curve", c.Exponent, c.Type)
+		}
+	case CurvePiecewise:
+		if len(c.Points) == 0 {
+			return fmt.Errorf("piecewise curve needs at least one point")
+		}
+		for i, p := range c.Points {
+			// Written so that NaN fails the range checks
+			if !(p.X >= 0 && p.X <= 1) || !(p.Y >= 0 && p.Y <= 1) {
+				return fmt.Errorf("piecewise curve point %d (%v, %v) is outside of [0.0, 1.0]", i, p.X, p.Y)
+			}
+			if i > 0 && p.X <= c.Points[i-1].X {
+				return fmt.Errorf("piecewise curve points must have strictly increasing inputs (point %d)", i)
+			}
+		}
+	case CurveLUT:
+		if len(c.Table) != 256 {
+			return fmt.Errorf("lookup table must have 256 entries, got %d", len(c.Table))
+		}
+	default:
+		return fmt.Errorf("unknown curve type %q", c.Type)
+	}
+	return nil
+}
+
+// exponent returns the exponent of the curve, defaulting to 2
+func (c Curve) exponent() float64 {
+	if c.Exponent == 0 {
+		return 2
+	}
+	return c.Exponent
+}
+
+// shape applies the curve to a magnitude between 0.0 and 1.0
+func (c Curve) shape(m float64) float64 {
+	m = clampFloat(m, 0, 1)
+	switch c.Type {
+	case CurveExponential:
+		return math.Pow(m, c.exponent())
+	case CurveSCurve:
+		a, b := math.Pow(m, c.exponent()), math.Pow(1-m, c.exponent())
+		return a / (a + b)
+	case CurvePiecewise:
+		points := c.Points
+		if m <= points[0].X {
+			return points[0].Y
+		}
+		for i := 1; i < len(points); i++ {
+			if m <= points[i].X {
+				p, q := points[i-1], points[i]
+				return p.Y + (q.Y-p.Y)*(m-p.X)/(q.X-p.X)
+			}
+		}
+		return points[len(points)-1].Y
+	default:
+		return m
+	}
+}
+
+// applyStick applies the curve to a joystick axis value (-1.0 to 1.0)
+func (c *Curve) applyStick(v float64) float64 {
+	if c == nil || math.IsNaN(v) {
+		return v
+	}
+	if c.Type == CurveLUT {
+		return ds4AxisToFloat(c.Table[ds4AxisFromFloat(v)])
+	}
+	return math.Copysign(c.shape(math.Abs(v)), v)
+}
+
+// applyTrigger applies the curve to a trigger value (0.0-1.0)
+func (c *Curve) applyTrigger(v float64) float64 {
+	if c == nil || math.IsNaN(v) {
+		return v
+	}
+	if c.Type == CurveLUT {
+		return triggerToFloat(c.Table[triggerFromFloat(v)])
+	}
+	return c.shape(v)
+}
+
+// SetCurve sets the response curve applied to an axis by the float setters.
+// Curves are applied before the processing set with SetLeftJoystickProcessing, etc.
+// Use Curve{} (linear) to remove a curve.
+func (g *BaseGamepad) SetCurve(axis Axis, curve Curve) error {
+	if err := curve.Validate(); err != nil {
+		return err
+	}
+	var c *Curve
+	if curve.Type != CurveLinear {
+		curve.Points = append([]Point(nil), curve.Points...)
+		curve.Table = append([]uint8(nil), curve.Table...)
+		c = &curve
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch axis {
+	case AxisLeftX:
+		g.leftStick.curveX = c
+	case AxisLeftY:
+		g.leftStick.curveY = c
+	case AxisRightX:
+		g.rightStick.curveX = c
+	case AxisRightY:
+		g.rightStick.curveY = c
+	case AxisLeftTrigger:
+		g.leftTrigger.curve = c
+	case AxisRightTrigger:
+		g.rightTrigger.curve = c
+	default:
+		return fmt.Errorf("invalid axis %d", int(axis))
+	}
+	return nil
+}
+
+// GetCurve returns the response curve applied to an axis by the float setters
+func (g *BaseGamepad) GetCurve(axis Axis) Curve {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var c *Curve
+	switch axis {
+	case AxisLeftX:
+		c = g.leftStick.curveX
+	case AxisLeftY:
+		c = g.leftStick.curveY
+	case AxisRightX:
+		c = g.rightStick.curveX
+	case AxisRightY:
+		c = g.rightStick.curveY
+	case AxisLeftTrigger:
+		c = g.leftTrigger.curve
+	case AxisRightTrigger:
+		c = g.rightTrigger.curve
+	}
+	if c == nil {
+		return Curve{}
+	}
+	return *c
+}
@@ -0,0 +1,172 @@
+package vgamepad
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCurvesKeepTheEnds(t *testing.T) {
+	curves := []Curve{
+		{},
+		{Type: CurveExponential},
+		{Type: CurveExponential, Exponent: 0.5},
+		{Type: CurveSCurve},
+		{Type: CurveSCurve, Exponent: 4},
+		{Type: CurvePiecewise, Points: []Point{{0, 0}, {0.3, 0.1}, {0.7, 0.9}, {1, 1}}},
+	}
+	for _, c := range curves {
+		if v := c.shape(0); v != 0 {
+			t.Errorf("%+v: shape(0) = %v", c, v)
+		}
+		if v := c.shape(1); v != 1 {
+			t.Errorf("%+v: shape(1) = %v", c, v)
+		}
+		previous := 0.0
+		for i := 1; i <= 100; i++ {
+			v := c.shape(float64(i) / 100)
+			if v < previous {
+				t.Errorf("%+v: shape(%v) = %v, below %v", c, float64(i)/100, v, previous)
+			}
+			previous = v
+		}
+		// A stick keeps its sign, and the curve is the same both ways
+		if a, b := c.applyStick(0.4), c.applyStick(-0.4); a != -b {
+			t.Errorf("%+v: applyStick(±0.4) = %v, %v", c, a, b)
+		}
+	}
+}
+
+func TestSCurveIsSymmetric(t *testing.T) {
+	c := Curve{Type: CurveSCurve, Exponent: 3}
+	for i := 0; i <= 20; i++ {
+		m := float64(i) / 20
+		if a, b := c.shape(m), 1-c.shape(1-m); !approx(a, b) {
+			t.Errorf("shape(%v) = %v, 1 - shape(%v) = %v", m, a, 1-m, b)
+		}
+	}
+	// Slow around the center and the edges
+	if v := c.shape(0.1); v >= 0.1 {
+		t.Errorf("shape(0.1) = %v, want below 0.1", v)
+	}
+}
+
+func TestPiecewiseOutsideOfThePoints(t *testing.T) {
+	// Points do not have to cover [0, 1]: the ends are flat
+	c := Curve{Type: CurvePiecewise, Points: []Point{{0.2, 0.1}, {0.8, 0.9}}}
+	for m, want := range map[float64]float64{0: 0.1, 0.2: 0.1, 0.5: 0.5, 0.8: 0.9, 1: 0.9} {
+		if v := c.shape(m); !approx(v, want) {
+			t.Errorf("shape(%v) = %v, want %v", m, v, want)
+		}
+	}
+	// A single point is a constant
+	single := Curve{Type: CurvePiecewise, Points: []Point{{0.5, 0.3}}}
+	if a, b := single.shape(0), single.shape(1); a != 0.3 || b != 0.3 {
+		t.Errorf("single point: %v, %v, want 0.3", a, b)
+	}
+}
+
+func TestLookupTable(t *testing.T) {
+	identity := make([]uint8, 256)
+	for i := range identity {
+		identity[i] = uint8(i)
+	}
+	c := &Curve{Type: CurveLUT, Table: identity}
+	// An identity table only quantizes to the DS4 steps
+	for i := 0; i <= 200; i++ {
+		v := float64(i)/100 - 1
+		if got := c.applyStick(v); math.Abs(got-v) > readTolerance+1e-12 {
+			t.Errorf("identity applyStick(%v) = %v", v, got)
+		}
+		if v >= 0 {
+			if got := c.applyTrigger(v); math.Abs(got-v) > 0.5/255+1e-12 {
+				t.Errorf("identity applyTrigger(%v) = %v", v, got)
+			}
+		}
+	}
+
+	// A table replaces values outright, even the neutral one
+	dead := &Curve{Type: CurveLUT, Table: make([]uint8, 256)}
+	if got := dead.applyTrigger(0); got != 0 {
+		t.Errorf("all-zero table applyTrigger(0) = %v", got)
+	}
+	if got := dead.applyStick(0); got != -1 {
+		t.Errorf("all-zero table applyStick(0) = %v, want -1", got)
+	}
+	if got := dead.applyStick(math.NaN()); !math.IsNaN(got) {
+		t.Errorf("applyStick(NaN) = %v, want NaN for the processing to handle", got)
+	}
+}
+
+func TestCurveValidateErrors(t *testing.T) {
+	for reason, c := range map[string]Curve{
+		"invalid exponent -1":      {Type: CurveExponential, Exponent: -1},
+		"invalid exponent NaN":     {Type: CurveSCurve, Exponent: math.NaN()},
+		"at least one point":       {Type: CurvePiecewise},
+		"outside of [0.0, 1.0]":    {Type: CurvePiecewise, Points: []Point{{0.5, math.NaN()}}},
+		"strictly increasing":      {Type: CurvePiecewise, Points: []Point{{0.5, 0}, {0.5, 1}}},
+		"256 entries, got 255":     {Type: CurveLUT, Table: make([]uint8, 255)},
+		`unknown curve type "sin"`: {Type: "sin"},
+	} {
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("Validate(%+v) = %v, want an error about %q", c, err, reason)
+		}
+	}
+}
+
+func TestSetCurve(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	points := []Point{{0, 0}, {0.5, 0.1}, {1, 1}}
+	if err := g.SetCurve(AxisRightY, Curve{Type: CurvePiecewise, Points: points}); err != nil {
+		t.Fatal(err)
+	}
+	// The curve keeps its own copy of the points
+	points[1].Y = 0.9
+	g.RightJoystickFloat(0.5, -0.5)
+	if r := g.GetReport(); r.SThumbRX != x360AxisFromFloat(0.5) || r.SThumbRY != x360AxisFromFloat(-0.1) {
+		t.Errorf("right joystick (0.5, -0.5) = %d, %d, want only Y curved", r.SThumbRX, r.SThumbRY)
+	}
+	if c := g.GetCurve(AxisRightY); c.Points[1].Y != 0.1 {
+		t.Errorf("GetCurve() point = %v, want the one given to SetCurve", c.Points[1])
+	}
+
+	// Invalid curves and axes are rejected without changing anything
+	if err := g.SetCurve(AxisRightY, Curve{Type: CurveLUT}); err == nil {
+		t.Error("SetCurve with an empty table succeeded")
+	}
+	if err := g.SetCurve(Axis(axisCount), Curve{}); err == nil {
+		t.Error("SetCurve on an invalid axis succeeded")
+	}
+	if c := g.GetCurve(AxisRightY); c.Type != CurvePiecewise {
+		t.Errorf("GetCurve() = %+v after rejected calls", c)
+	}
+
+	// Linear removes the curve
+	g.SetCurve(AxisRightY, Curve{})
+	if c := g.GetCurve(AxisRightY); c.Type != CurveLinear || c.Points != nil {
+		t.Errorf("GetCurve() = %+v, want linear", c)
+	}
+}
+
+func TestAxisJSONKeys(t *testing.T) {
+	curves := map[Axis]Curve{AxisLeftTrigger: {Type: CurveExponential, Exponent: 3}}
+	data, err := json.Marshal(curves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"left_trigger":{"type":"exponential","exponent":3}}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	var back map[Axis]Curve
+	if err := json.Unmarshal(data, &back); err != nil || back[AxisLeftTrigger].Exponent != 3 {
+		t.Errorf("Unmarshal = %v, %v", back, err)
+	}
+	if err := json.Unmarshal([]byte(`{"left_z":{}}`), &back); err == nil {
+		t.Error("Unmarshal of an unknown axis succeeded")
+	}
+	if s := Axis(-1).String(); s != "Axis(-1)" {
+		t.Errorf("Axis(-1).String() = %q", s)
+	}
+}
@@ -3,7 +3,9 @@ package vgamepad
 import (
 	"fmt"
 	"math"
+	"runtime"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/CB2Moon/vgamepad-go/internal/vigem"
@@ -14,17 +16,17 @@ import (
 type VDS4Gamepad struct {
 	*BaseGamepad
 	report commons.DS4Report
+	dpad   uint16 // Held directions of the directional pad (XUSB_GAMEPAD_DPAD_* bits), sent as a hat value
 }
 
 // NewVDS4Gamepad creates a new virtual DualShock 4 gamepad
 func NewVDS4Gamepad() (*VDS4Gamepad, error) {
-	base, err := NewBaseGamepad(func() (uintptr, error) {
-		client, err := vigem.NewViGEmClient()
-		if err != nil {
-			return 0, err
-		}
-		return client.TargetDS4Alloc()
-	})
+	return newVDS4Gamepad(0, 0)
+}
+
+// newVDS4Gamepad creates a new virtual DualShock 4 gamepad with the given vendor and product IDs (0 keeps the default)
+func newVDS4Gamepad(vid, pid uint16) (*VDS4Gamepad, error) {
+	base, err := newBaseGamepad((*vigem.ViGEmClient).TargetDS4Alloc, vid, pid)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +43,11 @@ func NewVDS4Gamepad() (*VDS4Gamepad, error) {
 		return nil, err
 	}
 
+	// Safety net for gamepads dropped without being closed. It only works for gamepads
+	// no background work refers to any more: turbo, a watchdog, reconnection or running
+	// timed actions keep them reachable until Close.
+	runtime.SetFinalizer(gamepad, (*VDS4Gamepad).Close)
+
 	return gamepad, nil
 }
 
@@ -62,90 +69,347 @@ func getDefaultDS4Report() commons.DS4Report {
 
 // Reset resets the gamepad to default state
 func (g *VDS4Gamepad) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.reset()
+}
+
+// restoreDefaults resets the report and every setting, and unregisters the notification,
+// so that the gamepad is as if it had just been created. Call Update to send the report.
+func (g *VDS4Gamepad) restoreDefaults() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmpFunc != nil {
+		g.client.TargetDS4UnregisterNotification(g.devicep)
+		g.cmpFunc = nil
+	}
+	g.resetSettings()
+	g.reset()
+}
+
+// reset resets the gamepad without locking (g.mu must be held)
+func (g *VDS4Gamepad) reset() {
+	g.disownAll()
+	g.resetLatches()
 	g.report = getDefaultDS4Report()
+	g.dpad = 0
+	g.noteDPad(0)
+}
+
+// SetReport replaces the whole report, e.g. with a report built elsewhere
+func (g *VDS4Gamepad) SetReport(report commons.DS4Report) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disownAll()
+	g.report = report
+	g.dpad = uint16(commons.DS4DPadToXUSB(commons.DS4DPadDirection(report.WButtons & 0xF)))
+	g.noteDPad(g.dpad)
+}
+
+// mergeReport replaces the report like SetReport, except for the controls owned by timed actions,
+// which keep their values and their actions
+func (g *VDS4Gamepad) mergeReport(report commons.DS4Report) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	dpad := uint16(commons.DS4DPadToXUSB(commons.DS4DPadDirection(report.WButtons & 0xF)))
+	for a := range g.actions {
+		switch c := a.control; c.kind {
+		case controlButton:
+			if c.mask&0xF != 0 {
+				dpad = g.dpad
+			}
+			report.WButtons = report.WButtons&^(c.mask&^0xF) | g.report.WButtons&c.mask&^0xF
+		case controlSpecialButton:
+			report.BSpecial = report.BSpecial&^uint8(c.mask) | g.report.BSpecial&uint8(c.mask)
+		case controlLeftTrigger:
+			bit := uint16(commons.DS4_BUTTON_TRIGGER_LEFT)
+			report.BTriggerL = g.report.BTriggerL
+			report.WButtons = report.WButtons&^bit | g.report.WButtons&bit
+		case controlRightTrigger:
+			bit := uint16(commons.DS4_BUTTON_TRIGGER_RIGHT)
+			report.BTriggerR = g.report.BTriggerR
+			report.WButtons = report.WButtons&^bit | g.report.WButtons&bit
+		case controlLeftJoystick:
+			report.BThumbLX, report.BThumbLY = g.report.BThumbLX, g.report.BThumbLY
+		case controlRightJoystick:
+			report.BThumbRX, report.BThumbRY = g.report.BThumbRX, g.report.BThumbRY
+		}
+	}
+	g.report = report
+	g.dpad = dpad
+	g.noteDPad(g.dpad)
+}
+
+// GetReport returns the current report, before SOCD cleaning, turbo and humanization
+func (g *VDS4Gamepad) GetReport() commons.DS4Report {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	report := g.report
+	commons.DS4SetDPad(&report, commons.XUSBToDS4DPad(commons.XUSBButton(g.dpad)))
+	return report
 }
 
 // Update sends the current report to the virtual device
 func (g *VDS4Gamepad) Update() error {
-	return g.client.TargetDS4Update(g.busp, g.devicep, g.report)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.feedWatchdog()
+	if err := g.takeInputError(); err != nil {
+		return err
+	}
+	if err := g.selfHeal(g.update()); err != nil {
+		g.publish(EventUpdateError, err)
+		return err
+	}
+	return nil
+}
+
+// update sends the current report without locking (g.mu must be held)
+func (g *VDS4Gamepad) update() error {
+	err := g.client.TargetDS4Update(g.busp, g.devicep, g.buildReport())
+	g.wakeRefresh()
+	return err
+}
+
+// buildReport returns the report to send, i.e. the current report with SOCD cleaning, turbo and humanization applied
+func (g *VDS4Gamepad) buildReport() commons.DS4Report {
+	report := g.report
+	now := time.Now()
+	g.noteDPad(g.dpad)
+	commons.DS4SetDPad(&report, commons.XUSBToDS4DPad(commons.XUSBButton(g.resolveSOCD(g.dpad))))
+	report.WButtons = applyButtonTurbo(g.turbos, controlButton, report.WButtons, now)
+	report.BSpecial = uint8(applyButtonTurbo(g.turbos, controlSpecialButton, uint16(report.BSpecial), now))
+	report.BTriggerL, report.WButtons = applyDS4TriggerTurbo(g.turbos, controlLeftTrigger, report.BTriggerL, report.WButtons, commons.DS4_BUTTON_TRIGGER_LEFT, now)
+	report.BTriggerR, report.WButtons = applyDS4TriggerTurbo(g.turbos, controlRightTrigger, report.BTriggerR, report.WButtons, commons.DS4_BUTTON_TRIGGER_RIGHT, now)
+	g.humanize(&report, now)
+	return report
+}
+
+// applyDS4TriggerTurbo is applyTriggerTurbo for DS4 triggers, whose digital bit is released together with the axis
+func applyDS4TriggerTurbo(turbos map[control]*turboState, kind controlKind, value uint8, buttons uint16, bit commons.DS4Button, now time.Time) (uint8, uint16) {
+	t, ok := turbos[control{kind: kind}]
+	if !ok || t.active(value > 0 || buttons&uint16(bit) != 0, now) {
+		return value, buttons
+	}
+	return 0, buttons &^ uint16(bit)
 }
 
 // PressButton presses a button (no effect if already pressed)
 func (g *VDS4Gamepad) PressButton(button commons.DS4Button) {
-	g.report.WButtons = g.report.WButtons | uint16(button)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: uint16(button)})
+	g.setButtons(g.pressLatched(controlButton, uint16(button)), true)
 }
 
 // ReleaseButton releases a button (no effect if already released)
 func (g *VDS4Gamepad) ReleaseButton(button commons.DS4Button) {
-	g.report.WButtons = g.report.WButtons &^ uint16(button)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: uint16(button)})
+	g.setButtons(g.releaseLatched(controlButton, uint16(button)), false)
 }
 
 // PressSpecialButton presses a special button (no effect if already pressed)
 func (g *VDS4Gamepad) PressSpecialButton(specialButton commons.DS4SpecialButton) {
-	g.report.BSpecial = g.report.BSpecial | uint8(specialButton)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlSpecialButton, mask: uint16(specialButton)})
+	g.setSpecialButtons(g.pressLatched(controlSpecialButton, uint16(specialButton)), true)
 }
 
 // ReleaseSpecialButton releases a special button (no effect if already released)
 func (g *VDS4Gamepad) ReleaseSpecialButton(specialButton commons.DS4SpecialButton) {
-	g.report.BSpecial = g.report.BSpecial &^ uint8(specialButton)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlSpecialButton, mask: uint16(specialButton)})
+	g.setSpecialButtons(g.releaseLatched(controlSpecialButton, uint16(specialButton)), false)
 }
 
 // LeftTrigger sets the value (0-255, 0 = trigger released) of the left trigger
 func (g *VDS4Gamepad) LeftTrigger(value uint8) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftTrigger})
 	g.report.BTriggerL = value
 }
 
 // RightTrigger sets the value (0-255, 0 = trigger released) of the right trigger
 func (g *VDS4Gamepad) RightTrigger(value uint8) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightTrigger})
 	g.report.BTriggerR = value
 }
 
 // LeftTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the left trigger using a float
 func (g *VDS4Gamepad) LeftTriggerFloat(valueFloat float64) {
-	g.LeftTrigger(uint8(math.Round(valueFloat * 255)))
+	if !g.checkInput("LeftTriggerFloat", 0, 1, valueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftTrigger})
+	g.leftTriggerFloat(valueFloat)
 }
 
 // RightTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the right trigger using a float
 func (g *VDS4Gamepad) RightTriggerFloat(valueFloat float64) {
-	g.RightTrigger(uint8(math.Round(valueFloat * 255)))
+	if !g.checkInput("RightTriggerFloat", 0, 1, valueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightTrigger})
+	g.rightTriggerFloat(valueFloat)
+}
+
+// leftTriggerFloat runs a float value through the pipeline of the left trigger and sets it,
+// without locking or taking ownership (g.mu must be held)
+func (g *VDS4Gamepad) leftTriggerFloat(valueFloat float64) {
+	g.report.BTriggerL = triggerFromFloat(g.leftTrigger.apply(valueFloat))
+}
+
+// rightTriggerFloat runs a float value through the pipeline of the right trigger and sets it,
+// without locking or taking ownership (g.mu must be held)
+func (g *VDS4Gamepad) rightTriggerFloat(valueFloat float64) {
+	g.report.BTriggerR = triggerFromFloat(g.rightTrigger.apply(valueFloat))
+}
+
+// GetLeftTriggerFloat returns the value (0.0-1.0) of the left trigger
+func (g *VDS4Gamepad) GetLeftTriggerFloat() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return triggerToFloat(g.report.BTriggerL)
+}
+
+// GetRightTriggerFloat returns the value (0.0-1.0) of the right trigger
+func (g *VDS4Gamepad) GetRightTriggerFloat() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return triggerToFloat(g.report.BTriggerR)
 }
 
 // LeftJoystick sets the values (0-255, 128 = neutral position) of the X and Y axis for the left joystick
 func (g *VDS4Gamepad) LeftJoystick(xValue, yValue uint8) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftJoystick})
 	g.report.BThumbLX = xValue
 	g.report.BThumbLY = yValue
 }
 
 // RightJoystick sets the values (0-255, 128 = neutral position) of the X and Y axis for the right joystick
 func (g *VDS4Gamepad) RightJoystick(xValue, yValue uint8) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightJoystick})
 	g.report.BThumbRX = xValue
 	g.report.BThumbRY = yValue
 }
 
-// LeftJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the left joystick using floats
+// LeftJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the left joystick using floats.
+// Y points up (1.0 = up) unless the AxisRaw convention is selected.
 func (g *VDS4Gamepad) LeftJoystickFloat(xValueFloat, yValueFloat float64) {
-	g.LeftJoystick(
-		uint8(128+math.Round(xValueFloat*127)),
-		uint8(128+math.Round(yValueFloat*127)),
-	)
+	if !g.checkInput("LeftJoystickFloat", -1, 1, xValueFloat, yValueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftJoystick})
+	g.leftJoystickFloat(xValueFloat, yValueFloat)
 }
 
-// RightJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the right joystick using floats
+// GetLeftJoystickFloat returns the values (-1.0 to 1.0) of the X and Y axis of the left joystick,
+// with the same Y direction as LeftJoystickFloat
+func (g *VDS4Gamepad) GetLeftJoystickFloat() (float64, float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return ds4AxisToFloat(g.report.BThumbLX), g.yAxisToFloat(g.report.BThumbLY)
+}
+
+// RightJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the right joystick using floats.
+// Y points up (1.0 = up) unless the AxisRaw convention is selected.
 func (g *VDS4Gamepad) RightJoystickFloat(xValueFloat, yValueFloat float64) {
-	g.RightJoystick(
-		uint8(128+math.Round(xValueFloat*127)),
-		uint8(128+math.Round(yValueFloat*127)),
-	)
+	if !g.checkInput("RightJoystickFloat", -1, 1, xValueFloat, yValueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightJoystick})
+	g.rightJoystickFloat(xValueFloat, yValueFloat)
+}
+
+// leftJoystickFloat runs float values through the pipeline of the left joystick and sets them,
+// without locking or taking ownership (g.mu must be held)
+func (g *VDS4Gamepad) leftJoystickFloat(xValueFloat, yValueFloat float64) {
+	xValueFloat, yValueFloat = g.leftStick.apply(xValueFloat, yValueFloat)
+	g.report.BThumbLX = ds4AxisFromFloat(xValueFloat)
+	g.report.BThumbLY = g.yAxisFromFloat(yValueFloat)
+}
+
+// rightJoystickFloat runs float values through the pipeline of the right joystick and sets them,
+// without locking or taking ownership (g.mu must be held)
+func (g *VDS4Gamepad) rightJoystickFloat(xValueFloat, yValueFloat float64) {
+	xValueFloat, yValueFloat = g.rightStick.apply(xValueFloat, yValueFloat)
+	g.report.BThumbRX = ds4AxisFromFloat(xValueFloat)
+	g.report.BThumbRY = g.yAxisFromFloat(yValueFloat)
+}
+
+// GetRightJoystickFloat returns the values (-1.0 to 1.0) of the X and Y axis of the right joystick,
+// with the same Y direction as RightJoystickFloat
+func (g *VDS4Gamepad) GetRightJoystickFloat() (float64, float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return ds4AxisToFloat(g.report.BThumbRX), g.yAxisToFloat(g.report.BThumbRY)
 }
 
 // DirectionalPad sets the direction of the directional pad (hat)
 func (g *VDS4Gamepad) DirectionalPad(direction commons.DS4DPadDirection) {
-	commons.DS4SetDPad(&g.report, direction)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: 0xF})
+	g.dpad = uint16(commons.DS4DPadToXUSB(direction))
+	g.noteDPad(g.dpad)
 }
 
 // UpdateExtendedReport enables using DS4_REPORT_EX instead of DS4_REPORT (advanced users only)
 func (g *VDS4Gamepad) UpdateExtendedReport(extendedReport *commons.DS4ReportEx) error {
-	return g.client.TargetDS4UpdateExPtr(g.busp, g.devicep, extendedReport)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	err := g.client.TargetDS4UpdateExPtr(g.busp, g.devicep, extendedReport)
+	if err != nil {
+		g.publish(EventUpdateError, err)
+	}
+	return err
 }
 
 // RegisterNotification registers a callback function for notifications
@@ -156,18 +420,51 @@ func (g *VDS4Gamepad) RegisterNotification(callback NotificationCallback) error
 		return 0
 	})
 
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	g.cmpFunc = unsafe.Pointer(&callbackPtr)
 
 	err := g.client.TargetDS4RegisterNotification(g.busp, g.devicep, uintptr(g.cmpFunc), 0)
 	if err != nil {
 		return fmt.Errorf("failed to register notification: %w", err)
 	}
+	g.publish(EventNotificationRegistered, nil)
 
 	return nil
 }
 
 // UnregisterNotification unregisters a previously registered callback function
 func (g *VDS4Gamepad) UnregisterNotification() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	g.client.TargetDS4UnregisterNotification(g.devicep)
 	g.cmpFunc = nil
 }
+
+// ds4AxisFromFloat converts a joystick axis value from [-1.0, 1.0] to [1, 255], clamping it
+func ds4AxisFromFloat(value float64) uint8 {
+	return uint8(128 + math.Round(clampFloat(value, -1, 1)*127))
+}
+
+// yAxisFromFloat converts a float Y value to the report, following the axis convention (g.mu must be held)
+func (g *VDS4Gamepad) yAxisFromFloat(value float64) uint8 {
+	if g.axes == AxisRaw {
+		return ds4AxisFromFloat(value)
+	}
+	return ds4AxisFromFloat(-value)
+}
+
+// yAxisToFloat converts a Y value of the report to a float, following the axis convention (g.mu must be held)
+func (g *VDS4Gamepad) yAxisToFloat(value uint8) float64 {
+	if g.axes == AxisRaw {
+		return ds4AxisToFloat(value)
+	}
+	return -ds4AxisToFloat(value)
+}
+
+// ds4AxisToFloat converts a joystick axis value from [0, 255] to [-1.0, 1.0]
+func ds4AxisToFloat(value uint8) float64 {
+	return math.Max((float64(value)-128)/127, -1)
+}
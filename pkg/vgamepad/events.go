@@ -0,0 +1,233 @@
+package vgamepad
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// EventKind is the kind of a lifecycle event
+type EventKind int
+
+const (
+	EventBusConnected           EventKind = iota // The bus was connected
+	EventBusDisconnected                         // The bus was disconnected
+	EventTargetAdded                             // A gamepad was plugged in
+	EventTargetRemoved                           // A gamepad was unplugged
+	EventIdentityChanged                         // The VID or PID of a gamepad was set
+	EventNotificationRegistered                  // A notification callback was registered on a gamepad
+	EventUpdateError                             // A report could not be sent
+	EventReconnect                               // A gamepad was plugged back, or failed to be, after its target dropped
+	EventWatchdogTimeout                         // A gamepad was reset to neutral by its watchdog
+)
+
+// String returns a string representation of the EventKind
+func (k EventKind) String() string {
+	switch k {
+	case EventBusConnected:
+		return "bus connected"
+	case EventBusDisconnected:
+		return "bus disconnected"
+	case EventTargetAdded:
+		return "target added"
+	case EventTargetRemoved:
+		return "target removed"
+	case EventIdentityChanged:
+		return "identity changed"
+	case EventNotificationRegistered:
+		return "notification registered"
+	case EventUpdateError:
+		return "update error"
+	case EventReconnect:
+		return "reconnect"
+	case EventWatchdogTimeout:
+		return "watchdog timeout"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a lifecycle event of the bus or of a gamepad
+type Event struct {
+	Kind  EventKind
+	Time  time.Time
+	Index uint32                  // GetIndex() of the gamepad, 0 for bus events
+	Type  commons.ViGEmTargetType // GetType() of the gamepad, 0 for bus events
+	VID   uint16                  // Vendor ID of the gamepad, 0 for bus events
+	PID   uint16                  // Product ID of the gamepad, 0 for bus events
+	Err   error                   // Error of EventUpdateError and of failed EventReconnect
+}
+
+// Subscription receives lifecycle events
+type Subscription struct {
+	C <-chan Event // Events, in the order they happened
+
+	ch      chan Event
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+var (
+	// Subscriptions receiving the events
+	subscriptions   = make(map[*Subscription]struct{})
+	subscriptionsMu sync.Mutex
+)
+
+// Subscribe starts receiving the lifecycle events of the bus and of all the gamepads.
+// Events are dropped, not waited for, when buffer events are already pending.
+func Subscribe(buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	s := &Subscription{C: ch, ch: ch}
+
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+
+	subscriptions[s] = struct{}{}
+	return s
+}
+
+// Dropped returns the number of events dropped because the subscription was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops receiving events and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		subscriptionsMu.Lock()
+		defer subscriptionsMu.Unlock()
+
+		delete(subscriptions, s)
+		close(s.ch)
+	})
+}
+
+// hasSubscribers reports whether events are listened to, so that they are not built for nothing
+func hasSubscribers() bool {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+
+	return len(subscriptions) > 0
+}
+
+// Queue of the events waiting to be logged and published. Events are queued with the lock of
+// the bus or of a gamepad held, and delivered by a goroutine once it is released, so that the
+// logger and the subscribers can call the gamepads back.
+var (
+	eventQueue      []Event
+	eventDelivering bool // Whether a goroutine is delivering the queued events
+	eventQueueMu    sync.Mutex
+	eventDelivered  = sync.NewCond(&eventQueueMu) // Signaled when the queue is empty and delivered
+)
+
+// queueEvent queues an event for delivery, in the order of the calls
+func queueEvent(event Event) {
+	eventQueueMu.Lock()
+	defer eventQueueMu.Unlock()
+
+	eventQueue = append(eventQueue, event)
+	if !eventDelivering {
+		eventDelivering = true
+		go deliverEvents()
+	}
+}
+
+// deliverEvents logs and publishes the queued events until the queue is empty
+func deliverEvents() {
+	eventQueueMu.Lock()
+	for len(eventQueue) > 0 {
+		event := eventQueue[0]
+		eventQueue = eventQueue[1:]
+		eventQueueMu.Unlock()
+
+		event.log()
+		publish(event)
+
+		eventQueueMu.Lock()
+	}
+	eventQueue = nil
+	eventDelivering = false
+	eventDelivered.Broadcast()
+	eventQueueMu.Unlock()
+}
+
+// flushEvents waits until the queued events are delivered
+func flushEvents() {
+	eventQueueMu.Lock()
+	defer eventQueueMu.Unlock()
+
+	for eventDelivering {
+		eventDelivered.Wait()
+	}
+}
+
+// publish sends an event to every subscription
+func publish(event Event) {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+
+	for s := range subscriptions {
+		select {
+		case s.ch <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// publishBus logs and publishes an event of the bus
+func publishBus(kind EventKind) {
+	if commons.GetLogger() == nil && !hasSubscribers() {
+		return
+	}
+	queueEvent(Event{Kind: kind, Time: time.Now()})
+}
+
+// publish logs and publishes an event of the gamepad, with the identity of its current
+// target (g.mu must be held, or the target not shared yet)
+func (g *BaseGamepad) publish(kind EventKind, err error) {
+	if (commons.GetLogger() == nil && !hasSubscribers()) || g.devicep == 0 {
+		return
+	}
+	queueEvent(Event{
+		Kind:  kind,
+		Time:  time.Now(),
+		Index: g.identity.index,
+		Type:  g.identity.targetType,
+		VID:   g.identity.vid,
+		PID:   g.identity.pid,
+		Err:   err,
+	})
+}
+
+// log logs the event, if a logger is set
+func (e Event) log() {
+	logger := commons.GetLogger()
+	if logger == nil {
+		return
+	}
+	if e.Kind == EventBusConnected || e.Kind == EventBusDisconnected {
+		logger.Log(commons.LogInfo, e.Kind.String())
+		return
+	}
+	keyvals := []interface{}{"index", e.Index, "type", e.Type, "vid", e.VID, "pid", e.PID}
+	if e.Err != nil {
+		keyvals = append(keyvals, "error", e.Err)
+	}
+	logger.Log(e.level(), e.Kind.String(), keyvals...)
+}
+
+// level returns the level at which an event is logged
+func (e Event) level() commons.LogLevel {
+	switch {
+	case e.Err != nil:
+		return commons.LogError
+	case e.Kind == EventWatchdogTimeout:
+		return commons.LogWarn
+	case e.Kind == EventIdentityChanged || e.Kind == EventNotificationRegistered:
+		return commons.LogDebug
+	}
+	return commons.LogInfo
+}
@@ -0,0 +1,145 @@
+package vgamepad
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// eventPad returns a plugged-in gamepad with a known identity, that never calls the DLL to publish
+func eventPad() *BaseGamepad {
+	return &BaseGamepad{devicep: 1, identity: targetIdentity{index: 3, targetType: commons.DualShock4Wired, vid: 0x054C, pid: 0x05C4}}
+}
+
+// publishLocked publishes an event the way the gamepads do, with g.mu held
+func publishLocked(g *BaseGamepad, kind EventKind, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.publish(kind, err)
+}
+
+func TestEventKindString(t *testing.T) {
+	if got := EventWatchdogTimeout.String(); got != "watchdog timeout" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := EventKind(99).String(); got != "EventKind(99)" {
+		t.Errorf("unknown kind = %q", got)
+	}
+}
+
+func TestEventsCarryTheCachedIdentity(t *testing.T) {
+	s := Subscribe(10)
+	defer s.Close()
+
+	g := eventPad()
+	broken := errors.New("broken")
+	publishLocked(g, EventUpdateError, broken)
+	flushEvents()
+	event := <-s.C
+	if event.Kind != EventUpdateError || event.Err != broken || event.Time.IsZero() {
+		t.Errorf("event = %+v", event)
+	}
+	if event.Index != 3 || event.Type != commons.DualShock4Wired || event.VID != 0x054C || event.PID != 0x05C4 {
+		t.Errorf("identity = %d, %v, %#x, %#x", event.Index, event.Type, event.VID, event.PID)
+	}
+
+	// An unplugged gamepad publishes nothing
+	g.devicep = 0
+	publishLocked(g, EventTargetRemoved, nil)
+	flushEvents()
+	select {
+	case event := <-s.C:
+		t.Errorf("unplugged gamepad published %v", event.Kind)
+	default:
+	}
+}
+
+func TestEventsDeliveredOutsideOfTheLock(t *testing.T) {
+	g := eventPad()
+	var levels []commons.LogLevel
+	commons.SetLogger(commons.LoggerFunc(func(level commons.LogLevel, msg string, keyvals ...interface{}) {
+		// A logger using the gamepad would deadlock if it was called with g.mu held
+		g.mu.Lock()
+		levels = append(levels, level)
+		g.mu.Unlock()
+	}))
+	defer commons.SetLogger(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		publishLocked(g, EventTargetAdded, nil)
+		publishLocked(g, EventIdentityChanged, nil)
+		publishLocked(g, EventWatchdogTimeout, nil)
+		publishLocked(g, EventReconnect, errors.New("no slot"))
+		flushEvents()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the logger was called with the lock of the gamepad held")
+	}
+
+	want := []commons.LogLevel{commons.LogInfo, commons.LogDebug, commons.LogWarn, commons.LogError}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(levels) != len(want) {
+		t.Fatalf("logged %v, want %v", levels, want)
+	}
+	for i := range want {
+		if levels[i] != want[i] {
+			t.Errorf("levels = %v, want %v in order", levels, want)
+			break
+		}
+	}
+}
+
+func TestSubscriptionDrops(t *testing.T) {
+	s := Subscribe(1)
+	g := eventPad()
+	publishBus(EventBusConnected)
+	publishLocked(g, EventTargetAdded, nil)
+	publishLocked(g, EventTargetRemoved, nil)
+	flushEvents()
+
+	// The first event is kept, the others dropped rather than waited for
+	if event := <-s.C; event.Kind != EventBusConnected || event.Index != 0 {
+		t.Errorf("kept %+v, want the bus event", event)
+	}
+	if s.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", s.Dropped())
+	}
+
+	// Once closed, C is closed and nothing is sent to it any more
+	s.Close()
+	s.Close()
+	publishLocked(g, EventTargetAdded, nil)
+	flushEvents()
+	if _, ok := <-s.C; ok {
+		t.Error("C received an event after Close")
+	}
+}
+
+func TestWatchdogPublishesItsTimeout(t *testing.T) {
+	s := Subscribe(10)
+	defer s.Close()
+
+	g, _, timeouts := watchedGamepad(50 * time.Millisecond)
+	g.mu.Lock()
+	g.identity = eventPad().identity
+	g.mu.Unlock()
+	defer g.setWatchdog(0, nil, nil)
+	waitFor(t, "the watchdog to fire", func() bool { return timeouts.Load() == 1 })
+	flushEvents()
+	select {
+	case event := <-s.C:
+		if event.Kind != EventWatchdogTimeout || event.Index != 3 || event.Err != nil {
+			t.Errorf("event = %+v", event)
+		}
+	default:
+		t.Error("the watchdog timeout was not published")
+	}
+}
@@ -2,6 +2,7 @@ package vgamepad
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"sync"
 	"unsafe"
@@ -23,27 +24,53 @@ type NotificationCallback func(client, target uintptr, largeMotor, smallMotor, l
 type VBus struct {
 	client *vigem.ViGEmClient
 	busp   uintptr
+	gen    uint64 // Incremented each time the bus is reconnected
 	mu     sync.Mutex
 }
 
+// DefaultUpdateRate is the number of reports per second sent by background motions such as tweens
+const DefaultUpdateRate = 60
+
+// MaxUpdateRate is the highest update rate used, higher rates are clamped to it
+const MaxUpdateRate = 1000
+
 var (
 	// Global VBus instance for all controllers
 	globalVBus     *VBus
-	globalVBusOnce sync.Once
+	globalVBusMu   sync.Mutex
+	globalVBusDown bool // Set by Shutdown, after which no bus is created
 )
 
-// GetVBus returns the global VBus instance (singleton)
+// GetVBus returns the global VBus instance (singleton), or an error after Shutdown
 func GetVBus() (*VBus, error) {
-	var err error
-	globalVBusOnce.Do(func() {
-		globalVBus, err = newVBus()
-	})
-	if err != nil {
-		return nil, err
+	globalVBusMu.Lock()
+	defer globalVBusMu.Unlock()
+
+	if globalVBusDown {
+		return nil, fmt.Errorf("vgamepad was shut down")
+	}
+	if globalVBus == nil {
+		vbus, err := newVBus()
+		if err != nil {
+			return nil, err
+		}
+		globalVBus = vbus
 	}
 	return globalVBus, nil
 }
 
+// shutdownVBus closes the global VBus, if it was created, and prevents creating another one
+func shutdownVBus() {
+	globalVBusMu.Lock()
+	globalVBusDown = true
+	vbus := globalVBus
+	globalVBusMu.Unlock()
+
+	if vbus != nil {
+		vbus.Close()
+	}
+}
+
 // newVBus creates a new VBus instance
 func newVBus() (*VBus, error) {
 	client, err := vigem.NewViGEmClient()
@@ -53,14 +80,17 @@ func newVBus() (*VBus, error) {
 
 	busp, err := client.Alloc()
 	if err != nil {
+		commons.Log(commons.LogError, "failed to allocate ViGEm bus", "error", err)
 		return nil, fmt.Errorf("failed to allocate ViGEm bus: %w", err)
 	}
 
 	err = client.Connect(busp)
 	if err != nil {
 		client.Free(busp)
+		commons.Log(commons.LogError, "failed to connect to ViGEm bus", "error", err)
 		return nil, fmt.Errorf("failed to connect to ViGEm bus: %w", err)
 	}
+	publishBus(EventBusConnected)
 
 	return &VBus{
 		client: client,
@@ -77,9 +107,52 @@ func (v *VBus) Close() {
 		v.client.Disconnect(v.busp)
 		v.client.Free(v.busp)
 		v.busp = 0
+		publishBus(EventBusDisconnected)
 	}
 }
 
+// handle returns the handle of the bus, or an error if the bus is closed
+func (v *VBus) handle() (uintptr, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.busp == 0 {
+		return 0, fmt.Errorf("the bus is closed")
+	}
+	return v.busp, nil
+}
+
+// generation returns how many times the bus was reconnected
+func (v *VBus) generation() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.gen
+}
+
+// reconnect disconnects and connects the bus again, unless it was already reconnected since
+// generation gen, and returns the new generation. The handle of the bus stays the same.
+func (v *VBus) reconnect(gen uint64) (uint64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.busp == 0 {
+		return v.gen, fmt.Errorf("the bus is closed")
+	}
+	if v.gen != gen {
+		return v.gen, nil
+	}
+	v.client.Disconnect(v.busp)
+	publishBus(EventBusDisconnected)
+	if err := v.client.Connect(v.busp); err != nil {
+		commons.Log(commons.LogError, "failed to reconnect to ViGEm bus", "error", err)
+		return v.gen, fmt.Errorf("failed to reconnect to ViGEm bus: %w", err)
+	}
+	publishBus(EventBusConnected)
+	v.gen++
+	return v.gen, nil
+}
+
 // Gamepad is the interface for all gamepad types
 type Gamepad interface {
 	// Update sends the current report to the virtual device
@@ -122,11 +195,44 @@ type BaseGamepad struct {
 	client  *vigem.ViGEmClient
 	busp    uintptr
 	devicep uintptr
-	cmpFunc unsafe.Pointer // Keep reference to callback function
+	cmpFunc unsafe.Pointer                                   // Keep reference to callback function
+	alloc   func(client *vigem.ViGEmClient) (uintptr, error) // Allocates a target of the type of the gamepad
+	busGen  uint64                                           // Generation of the bus the target was added to
+	vid     uint16                                           // Vendor ID the target was plugged in with
+	pid     uint16                                           // Product ID the target was plugged in with
+
+	mu          sync.Mutex                // Guards the report and the fields below
+	actions     map[*TimedAction]struct{} // Timed actions currently owning a control
+	turbos      map[control]*turboState   // Controls with turbo enabled
+	refreshWake chan struct{}             // Wakes the refresh loop up, nil if it is not running
+	rate        float64                   // Reports per second sent by tweens and paths, 0 means DefaultUpdateRate
+	socd        SOCDMode                  // How opposite D-pad directions are resolved
+	dpadHeld    uint16                    // D-pad directions held (XUSB_GAMEPAD_DPAD_* bits)
+	dpadOrder   [4]uint64                 // Press order of the held D-pad directions (up, down, left, right)
+	dpadSeq     uint64                    // Last press order given to a D-pad direction
+	strict      bool                      // Whether float setters reject out-of-range values
+	inputErr    error                     // First value rejected in strict mode since the last Update (*InputRangeError)
+	axes        AxisConvention            // Direction of the Y axis of float joystick values
+	latches     map[control]*latchState   // Buttons with a latch mode, one bit each
+	watchdog    *watchdog                 // Neutralizes the gamepad when Update stops being called, nil if disabled
+	humanizer   *humanizer                // Humanization filters, nil if disabled
+	healer      *healer                   // Reconnects the target when it drops, nil if disabled
+	identity    targetIdentity            // Identity of the current target, given to events
+
+	leftStick, rightStick     stickPipeline   // Processing of the float joystick setters
+	leftTrigger, rightTrigger triggerPipeline // Processing of the float trigger setters
 }
 
 // NewBaseGamepad creates a new BaseGamepad
 func NewBaseGamepad(targetAlloc func() (uintptr, error)) (*BaseGamepad, error) {
+	return newBaseGamepad(func(*vigem.ViGEmClient) (uintptr, error) {
+		return targetAlloc()
+	}, 0, 0)
+}
+
+// newBaseGamepad creates a new BaseGamepad whose targets are allocated by alloc with the client
+// of the bus, with the given vendor and product IDs (0 keeps the default)
+func newBaseGamepad(alloc func(client *vigem.ViGEmClient) (uintptr, error), vid, pid uint16) (*BaseGamepad, error) {
 	if runtime.GOOS != "windows" {
 		return nil, fmt.Errorf("vgamepad is only supported on Windows")
 	}
@@ -135,66 +241,208 @@ func NewBaseGamepad(targetAlloc func() (uintptr, error)) (*BaseGamepad, error) {
 	if err != nil {
 		return nil, err
 	}
+	busp, err := vbus.handle()
+	if err != nil {
+		return nil, err
+	}
 
-	devicep, err := targetAlloc()
+	devicep, err := alloc(vbus.client)
 	if err != nil {
 		return nil, err
 	}
+	setIdentity(vbus.client, devicep, vid, pid)
 
-	err = vbus.client.TargetAdd(vbus.busp, devicep)
+	err = vbus.client.TargetAdd(busp, devicep)
 	if err != nil {
 		vbus.client.TargetFree(devicep)
+		commons.Log(commons.LogError, "failed to add target", "error", err)
 		return nil, err
 	}
 
 	if !vbus.client.TargetIsAttached(devicep) {
 		vbus.client.TargetFree(devicep)
+		commons.Log(commons.LogError, "failed to add target", "error", "not attached")
 		return nil, fmt.Errorf("the virtual device could not connect to ViGEmBus")
 	}
 
-	return &BaseGamepad{
+	g := &BaseGamepad{
 		vbus:    vbus,
 		client:  vbus.client,
-		busp:    vbus.busp,
+		busp:    busp,
 		devicep: devicep,
-	}, nil
+		alloc:   alloc,
+		busGen:  vbus.generation(),
+		vid:     vbus.client.TargetGetVid(devicep),
+		pid:     vbus.client.TargetGetPid(devicep),
+	}
+	g.cacheIdentity()
+	registerPad(g)
+	g.publish(EventTargetAdded, nil)
+	return g, nil
+}
+
+// targetIdentity identifies the target of a gamepad
+type targetIdentity struct {
+	index      uint32
+	targetType commons.ViGEmTargetType
+	vid, pid   uint16
+}
+
+// cacheIdentity reads the identity of the current target, so that events do not query the
+// target every time (g.mu must be held)
+func (g *BaseGamepad) cacheIdentity() {
+	g.identity = targetIdentity{
+		index:      g.client.TargetGetIndex(g.devicep),
+		targetType: g.client.TargetGetType(g.devicep),
+		vid:        g.client.TargetGetVid(g.devicep),
+		pid:        g.client.TargetGetPid(g.devicep),
+	}
+}
+
+// setIdentity sets the vendor and product IDs of a target before it is added to the bus (0 keeps the default)
+func setIdentity(client *vigem.ViGEmClient, devicep uintptr, vid, pid uint16) {
+	if vid != 0 {
+		client.TargetSetVid(devicep, vid)
+	}
+	if pid != 0 {
+		client.TargetSetPid(devicep, pid)
+	}
 }
 
 // Close closes the gamepad and removes it from the bus
 func (g *BaseGamepad) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disownAll()
+	g.resetLatches()
+	g.stopWatchdog()
+	g.stopHealer()
+	unregisterPad(g)
 	if g.devicep != 0 {
+		g.publish(EventTargetRemoved, nil)
 		g.client.TargetRemove(g.busp, g.devicep)
 		g.client.TargetFree(g.devicep)
 		g.devicep = 0
 	}
+	g.wakeRefresh()
+}
+
+// resetSettings restores every setting of the gamepad to its default: timed actions, latches,
+// turbo, watchdog, reconnection, humanization, curves, processing, SOCD mode, strict mode,
+// axis convention, update rate and identity. The report and the notification are left as they are (g.mu must be held)
+func (g *BaseGamepad) resetSettings() {
+	g.disownAll()
+	g.resetLatches()
+	g.latches = nil
+	g.stopWatchdog()
+	g.stopHealer()
+	g.turbos = nil
+	g.humanizer = nil
+	g.rate = 0
+	g.socd = SOCDNone
+	g.strict = false
+	g.inputErr = nil
+	g.axes = AxisNormalized
+	g.leftStick, g.rightStick = stickPipeline{}, stickPipeline{}
+	g.leftTrigger, g.rightTrigger = triggerPipeline{}, triggerPipeline{}
+	if g.devicep != 0 {
+		g.client.TargetSetVid(g.devicep, g.vid)
+		g.client.TargetSetPid(g.devicep, g.pid)
+		g.identity.vid, g.identity.pid = g.vid, g.pid
+	}
+	g.wakeRefresh()
+}
+
+// SetUpdateRate sets how many reports per second (Hz) are sent by background motions such as tweens,
+// up to MaxUpdateRate
+func (g *BaseGamepad) SetUpdateRate(rate float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rate = rate
+}
+
+// GetUpdateRate returns how many reports per second (Hz) are sent by background motions such as tweens
+func (g *BaseGamepad) GetUpdateRate() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.updateRate()
+}
+
+// updateRate returns the update rate, falling back to DefaultUpdateRate and clamped to MaxUpdateRate (g.mu must be held)
+func (g *BaseGamepad) updateRate() float64 {
+	if g.rate <= 0 || math.IsNaN(g.rate) {
+		return DefaultUpdateRate
+	}
+	return math.Min(g.rate, MaxUpdateRate)
 }
 
 // GetVID returns the vendor ID of the virtual device
 func (g *BaseGamepad) GetVID() uint16 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.client.TargetGetVid(g.devicep)
 }
 
 // GetPID returns the product ID of the virtual device
 func (g *BaseGamepad) GetPID() uint16 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.client.TargetGetPid(g.devicep)
 }
 
 // SetVID sets the vendor ID of the virtual device
 func (g *BaseGamepad) SetVID(vid uint16) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.client.TargetGetVid(g.devicep) == vid {
+		return
+	}
 	g.client.TargetSetVid(g.devicep, vid)
+	g.identity.vid = vid
+	g.publish(EventIdentityChanged, nil)
 }
 
 // SetPID sets the product ID of the virtual device
 func (g *BaseGamepad) SetPID(pid uint16) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.client.TargetGetPid(g.devicep) == pid {
+		return
+	}
 	g.client.TargetSetPid(g.devicep, pid)
+	g.identity.pid = pid
+	g.publish(EventIdentityChanged, nil)
 }
 
 // GetIndex returns the internally used index of the target device
 func (g *BaseGamepad) GetIndex() uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.client.TargetGetIndex(g.devicep)
 }
 
 // GetType returns the type of the object
 func (g *BaseGamepad) GetType() commons.ViGEmTargetType {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.client.TargetGetType(g.devicep)
 }
+
+// triggerFromFloat converts a trigger value from [0.0, 1.0] to [0, 255], clamping it
+func triggerFromFloat(value float64) uint8 {
+	return uint8(math.Round(clampFloat(value, 0, 1) * 255))
+}
+
+// triggerToFloat converts a trigger value from [0, 255] to [0.0, 1.0]
+func triggerToFloat(value uint8) float64 {
+	return float64(value) / 255
+}
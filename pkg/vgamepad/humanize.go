@@ -0,0 +1,255 @@
+package vgamepad
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// Humanize configures filters applied to the report on every Update, so that generated inputs
+// look less robotic. The filters can be combined, and the zero value disables all of them.
+// Joystick values are between -1.0 and 1.0 and trigger values between 0.0 and 1.0.
+type Humanize struct {
+	Smoothing float64 // Time constant, in seconds, of the low-pass filter on joysticks and triggers, 0 disables it
+	SlewRate  float64 // Maximum change per second of a joystick or trigger axis, 0 disables the limit
+
+	// Jitter is the standard deviation of the Gaussian noise added to each axis on every report.
+	// Noise is only added to joysticks that are off-center and triggers that are pressed.
+	Jitter float64
+
+	TremorAmplitude float64 // Amplitude of the micro-tremor added to joysticks and triggers, like Jitter
+	TremorFrequency float64 // Frequency of the micro-tremor in Hz, 0 means 10 Hz
+
+	PressDelay   time.Duration // Maximum random delay before a button press is sent
+	ReleaseDelay time.Duration // Maximum random delay before a button release is sent
+
+	// Seed seeds the random generator of the noise and the delays: the same seed
+	// gives the same sequence, for reproducible tests
+	Seed int64
+}
+
+// humanizer is the runtime state of the humanization filters
+type humanizer struct {
+	config Humanize
+	rng    *rand.Rand
+	start  time.Time          // When the filters were enabled, origin of the tremor
+	last   time.Time          // When the filters last ran, zero before the first time
+	target [axisCount]float64 // Values of the axes in the report
+	out    [axisCount]float64 // Filtered values, before noise
+	phase  [axisCount]float64 // Phase of the tremor of each axis
+	delays [2]buttonDelays    // Buttons and special buttons
+}
+
+// buttonDelays delays the changes of the buttons of a bitmask
+type buttonDelays struct {
+	out      uint16        // Buttons sent
+	deadline [16]time.Time // When the pending change of each button is sent, zero if none
+}
+
+// newHumanizer creates the state of the humanization filters
+func newHumanizer(config Humanize, now time.Time) *humanizer {
+	h := &humanizer{config: config, rng: rand.New(rand.NewSource(config.Seed)), start: now}
+	for i := range h.phase {
+		h.phase[i] = h.rng.Float64() * 2 * math.Pi
+	}
+	return h
+}
+
+// apply filters the axes and buttons of a report; only the buttons in mask are delayed
+func (h *humanizer) apply(axes *[axisCount]float64, buttons *uint16, mask uint16, special *uint8, now time.Time) {
+	dt := 0.0
+	if !h.last.IsZero() {
+		dt = now.Sub(h.last).Seconds()
+	}
+	h.last = now
+	h.target = *axes
+
+	c := h.config
+	for i := range axes {
+		out, target := h.out[i], axes[i]
+		if c.Smoothing > 0 {
+			out += (target - out) * (1 - math.Exp(-dt/c.Smoothing))
+		} else {
+			out = target
+		}
+		if c.SlewRate > 0 {
+			step := c.SlewRate * dt
+			out = h.out[i] + clampFloat(out-h.out[i], -step, step)
+		}
+		if math.Abs(target-out) < 1e-4 {
+			out = target
+		}
+		h.out[i] = out
+	}
+
+	t := now.Sub(h.start).Seconds()
+	for i := range axes {
+		v := h.out[i]
+		if h.noisy(Axis(i)) {
+			v += h.rng.NormFloat64()*c.Jitter + c.TremorAmplitude*math.Sin(2*math.Pi*h.tremorFrequency()*t+h.phase[i])
+		}
+		if i >= int(AxisLeftTrigger) {
+			axes[i] = clampFloat(v, 0, 1)
+		} else {
+			axes[i] = clampFloat(v, -1, 1)
+		}
+	}
+
+	*buttons = *buttons&^mask | h.delays[0].apply(*buttons, mask, h, now)
+	if special != nil {
+		*special = uint8(h.delays[1].apply(uint16(*special), 0xFF, h, now))
+	}
+}
+
+// tremorFrequency returns the frequency of the micro-tremor, defaulting to 10 Hz
+func (h *humanizer) tremorFrequency() float64 {
+	if h.config.TremorFrequency <= 0 {
+		return 10
+	}
+	return h.config.TremorFrequency
+}
+
+// noisy reports whether noise is added to an axis, i.e. its joystick is off-center or its trigger is pressed
+func (h *humanizer) noisy(axis Axis) bool {
+	switch axis {
+	case AxisLeftX, AxisLeftY:
+		return h.out[AxisLeftX] != 0 || h.out[AxisLeftY] != 0
+	case AxisRightX, AxisRightY:
+		return h.out[AxisRightX] != 0 || h.out[AxisRightY] != 0
+	default:
+		return h.out[axis] > 0
+	}
+}
+
+// moving reports whether the filters need more reports, i.e. axes are still converging or receiving noise
+func (h *humanizer) moving() bool {
+	if h.out != h.target {
+		return true
+	}
+	if h.config.Jitter == 0 && h.config.TremorAmplitude == 0 {
+		return false
+	}
+	for i := range h.out {
+		if h.noisy(Axis(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns when the next report must be sent, or false if none is needed
+func (h *humanizer) next(now time.Time, rate float64) (time.Time, bool) {
+	var next time.Time
+	if h.moving() {
+		next = now.Add(time.Duration(float64(time.Second) / rate))
+	}
+	for _, d := range h.delays {
+		for _, deadline := range d.deadline {
+			if !deadline.IsZero() && (next.IsZero() || deadline.Before(next)) {
+				next = deadline
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// apply returns the buttons in mask to send for the target buttons, drawing a random delay for each change
+func (d *buttonDelays) apply(target, mask uint16, h *humanizer, now time.Time) uint16 {
+	for i := range d.deadline {
+		bit := uint16(1) << i
+		if mask&bit == 0 || (target^d.out)&bit == 0 {
+			d.deadline[i] = time.Time{}
+			continue
+		}
+		if d.deadline[i].IsZero() {
+			max := h.config.ReleaseDelay
+			if target&bit != 0 {
+				max = h.config.PressDelay
+			}
+			if max < 0 {
+				max = 0
+			}
+			d.deadline[i] = now.Add(time.Duration(h.rng.Int63n(int64(max) + 1)))
+		}
+		if !now.Before(d.deadline[i]) {
+			d.out ^= bit
+			d.deadline[i] = time.Time{}
+		}
+	}
+	return d.out & mask
+}
+
+// setHumanize enables (or disables, with Humanize{}) the humanization filters and makes sure
+// the refresh loop runs to send the filtered reports
+func (g *BaseGamepad) setHumanize(config Humanize, update func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if config == (Humanize{}) {
+		g.humanizer = nil
+		return
+	}
+	g.humanizer = newHumanizer(config, time.Now())
+	g.startRefresh(update)
+}
+
+// SetHumanize enables (or disables, with Humanize{}) filters that smooth the joysticks and triggers,
+// add noise to them and delay button changes, so that generated inputs look human.
+// Enabling the filters resets their state (and random generator) and starts from a neutral pad.
+func (g *VX360Gamepad) SetHumanize(config Humanize) {
+	g.setHumanize(config, g.update)
+}
+
+// SetHumanize enables (or disables, with Humanize{}) filters that smooth the joysticks and triggers,
+// add noise to them and delay button changes, so that generated inputs look human.
+// Enabling the filters resets their state (and random generator) and starts from a neutral pad.
+// The directional pad is not delayed.
+func (g *VDS4Gamepad) SetHumanize(config Humanize) {
+	g.setHumanize(config, g.update)
+}
+
+// humanize applies the humanization filters to an Xbox 360 report (g.mu must be held)
+func (g *VX360Gamepad) humanize(report *commons.XUSBReport, now time.Time) {
+	if g.humanizer == nil {
+		return
+	}
+	axes := [axisCount]float64{
+		AxisLeftX:        x360AxisToFloat(report.SThumbLX),
+		AxisLeftY:        x360AxisToFloat(report.SThumbLY),
+		AxisRightX:       x360AxisToFloat(report.SThumbRX),
+		AxisRightY:       x360AxisToFloat(report.SThumbRY),
+		AxisLeftTrigger:  triggerToFloat(report.BLeftTrigger),
+		AxisRightTrigger: triggerToFloat(report.BRightTrigger),
+	}
+	g.humanizer.apply(&axes, &report.WButtons, 0xFFFF, nil, now)
+	report.SThumbLX = x360AxisFromFloat(axes[AxisLeftX])
+	report.SThumbLY = x360AxisFromFloat(axes[AxisLeftY])
+	report.SThumbRX = x360AxisFromFloat(axes[AxisRightX])
+	report.SThumbRY = x360AxisFromFloat(axes[AxisRightY])
+	report.BLeftTrigger = triggerFromFloat(axes[AxisLeftTrigger])
+	report.BRightTrigger = triggerFromFloat(axes[AxisRightTrigger])
+}
+
+// humanize applies the humanization filters to a DualShock 4 report (g.mu must be held)
+func (g *VDS4Gamepad) humanize(report *commons.DS4Report, now time.Time) {
+	if g.humanizer == nil {
+		return
+	}
+	axes := [axisCount]float64{
+		AxisLeftX:        ds4AxisToFloat(report.BThumbLX),
+		AxisLeftY:        ds4AxisToFloat(report.BThumbLY),
+		AxisRightX:       ds4AxisToFloat(report.BThumbRX),
+		AxisRightY:       ds4AxisToFloat(report.BThumbRY),
+		AxisLeftTrigger:  triggerToFloat(report.BTriggerL),
+		AxisRightTrigger: triggerToFloat(report.BTriggerR),
+	}
+	g.humanizer.apply(&axes, &report.WButtons, 0xFFF0, &report.BSpecial, now)
+	report.BThumbLX = ds4AxisFromFloat(axes[AxisLeftX])
+	report.BThumbLY = ds4AxisFromFloat(axes[AxisLeftY])
+	report.BThumbRX = ds4AxisFromFloat(axes[AxisRightX])
+	report.BThumbRY = ds4AxisFromFloat(axes[AxisRightY])
+	report.BTriggerL = triggerFromFloat(axes[AxisLeftTrigger])
+	report.BTriggerR = triggerFromFloat(axes[AxisRightTrigger])
+}
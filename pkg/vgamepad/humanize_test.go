@@ -0,0 +1,155 @@
+package vgamepad
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+func TestSmoothing(t *testing.T) {
+	h := newHumanizer(Humanize{Smoothing: 0.1}, epoch)
+	var axes [axisCount]float64
+
+	// The first report has no elapsed time: nothing moves yet
+	axes[AxisRightTrigger] = 1
+	h.apply(&axes, new(uint16), 0, nil, at(0))
+	if axes[AxisRightTrigger] != 0 {
+		t.Errorf("first report = %v, want 0", axes[AxisRightTrigger])
+	}
+
+	// One time constant later, the trigger covered 63% of the way
+	axes[AxisRightTrigger] = 1
+	h.apply(&axes, new(uint16), 0, nil, at(100))
+	if want := 1 - math.Exp(-1); !approx(axes[AxisRightTrigger], want) {
+		t.Errorf("after 100ms = %v, want %v", axes[AxisRightTrigger], want)
+	}
+
+	// It settles exactly on the target, and stops asking for reports
+	for ms := 200; ms <= 2000; ms += 100 {
+		axes[AxisRightTrigger] = 1
+		h.apply(&axes, new(uint16), 0, nil, at(ms))
+	}
+	if axes[AxisRightTrigger] != 1 {
+		t.Errorf("after 2s = %v, want 1", axes[AxisRightTrigger])
+	}
+	if _, ok := h.next(at(2000), 100); ok {
+		t.Error("next() wants a report once settled")
+	}
+}
+
+func TestSlewRate(t *testing.T) {
+	h := newHumanizer(Humanize{SlewRate: 2}, epoch)
+	var axes [axisCount]float64
+	h.apply(&axes, new(uint16), 0, nil, at(0))
+
+	// 2 per second: a full flick from one side to the other takes a second
+	for i, want := range []float64{-0.2, -0.4, -0.6} {
+		axes[AxisLeftX] = -1
+		h.apply(&axes, new(uint16), 0, nil, at(100*(i+1)))
+		if !approx(axes[AxisLeftX], want) {
+			t.Errorf("after %dms = %v, want %v", 100*(i+1), axes[AxisLeftX], want)
+		}
+	}
+	if next, ok := h.next(at(300), 100); !ok || !next.Equal(at(310)) {
+		t.Errorf("next() = %v, %v, want the next report at the refresh rate", next, ok)
+	}
+}
+
+func TestNoiseOnlyWhenActive(t *testing.T) {
+	h := newHumanizer(Humanize{Jitter: 0.05, TremorAmplitude: 0.02}, epoch)
+	var axes [axisCount]float64
+	axes[AxisLeftY] = 0.5
+	axes[AxisLeftTrigger] = 1
+	h.apply(&axes, new(uint16), 0, nil, at(10))
+
+	// The right joystick at rest and the released trigger stay exactly neutral
+	if axes[AxisRightX] != 0 || axes[AxisRightY] != 0 || axes[AxisRightTrigger] != 0 {
+		t.Errorf("controls at rest = %v", axes)
+	}
+	// Noise reaches both axes of an active joystick, and never past the range
+	if axes[AxisLeftX] == 0 || axes[AxisLeftY] == 0.5 {
+		t.Errorf("active joystick = %v, %v, want noise on both axes", axes[AxisLeftX], axes[AxisLeftY])
+	}
+	if axes[AxisLeftTrigger] > 1 {
+		t.Errorf("full trigger = %v, past 1", axes[AxisLeftTrigger])
+	}
+	// Noise keeps the reports coming even though nothing converges
+	if _, ok := h.next(at(10), 100); !ok {
+		t.Error("next() wants no report with noise on")
+	}
+}
+
+func TestHumanizeSeed(t *testing.T) {
+	run := func(seed int64) []float64 {
+		h := newHumanizer(Humanize{Jitter: 0.1, PressDelay: 50 * time.Millisecond, Seed: seed}, epoch)
+		var out []float64
+		for ms := 0; ms < 100; ms += 10 {
+			axes := [axisCount]float64{AxisRightX: 0.3}
+			buttons := uint16(1)
+			h.apply(&axes, &buttons, 0xFFFF, nil, at(ms))
+			out = append(out, axes[AxisRightX], float64(buttons))
+		}
+		return out
+	}
+
+	a, b, c := run(7), run(7), run(8)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed, value %d: %v and %v", i, a[i], b[i])
+		}
+	}
+	same := true
+	for i := range a {
+		same = same && a[i] == c[i]
+	}
+	if same {
+		t.Error("seeds 7 and 8 gave the same sequence")
+	}
+}
+
+func TestButtonDelays(t *testing.T) {
+	h := newHumanizer(Humanize{PressDelay: 40 * time.Millisecond, ReleaseDelay: 20 * time.Millisecond}, epoch)
+	var d buttonDelays
+
+	// The press is sent once its deadline passes, no later than PressDelay
+	if out := d.apply(0x3, 0x1, h, at(0)); out != 0 {
+		t.Errorf("pressed at 0 = %#x, want the press delayed", out)
+	}
+	deadline := d.deadline[0]
+	if deadline.Before(at(0)) || deadline.After(at(40)) {
+		t.Errorf("press deadline %v, want within 40ms", deadline.Sub(epoch))
+	}
+	if out := d.apply(0x3, 0x1, h, deadline); out != 0x1 {
+		t.Errorf("at the deadline = %#x, want only the masked button", out)
+	}
+	if d.deadline[1] != (time.Time{}) {
+		t.Error("a deadline was drawn for a button outside of the mask")
+	}
+
+	// A release that is undone before its deadline is never sent
+	d.apply(0, 0x1, h, at(100))
+	if out := d.apply(0x1, 0x1, h, at(101)); out != 0x1 || !d.deadline[0].IsZero() {
+		t.Errorf("release undone = %#x, deadline %v", out, d.deadline[0])
+	}
+}
+
+func TestHumanizeDS4DPad(t *testing.T) {
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+	g.humanizer = newHumanizer(Humanize{PressDelay: time.Hour}, epoch)
+
+	report := g.report
+	commons.DS4SetDPad(&report, commons.DS4_BUTTON_DPAD_SOUTH)
+	report.WButtons |= uint16(commons.DS4_BUTTON_CROSS)
+	report.BSpecial |= uint8(commons.DS4_SPECIAL_BUTTON_PS)
+	g.humanize(&report, at(0))
+
+	// The hat goes through right away, the buttons wait
+	if dpad := commons.DS4DPadDirection(report.WButtons & 0xF); dpad != commons.DS4_BUTTON_DPAD_SOUTH {
+		t.Errorf("D-pad = %v, want south", dpad)
+	}
+	if report.WButtons&^0xF != 0 || report.BSpecial != 0 {
+		t.Errorf("buttons %#x, special %#x, want both delayed", report.WButtons&^0xF, report.BSpecial)
+	}
+}
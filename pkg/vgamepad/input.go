@@ -0,0 +1,70 @@
+package vgamepad
+
+import (
+	"fmt"
+	"math"
+)
+
+// InputRangeError is returned by Update, in strict mode, when a float setter
+// received a value outside of its valid range (or NaN). The report is not sent.
+type InputRangeError struct {
+	Setter string  // Name of the setter, e.g. "LeftJoystickFloat"
+	Value  float64 // Rejected value
+	Min    float64 // Lower bound of the valid range
+	Max    float64 // Upper bound of the valid range
+}
+
+// Error returns a string representation of the InputRangeError
+func (e *InputRangeError) Error() string {
+	return fmt.Sprintf("%s: value %v out of range [%v, %v]", e.Setter, e.Value, e.Min, e.Max)
+}
+
+// SetStrictInput enables or disables strict mode.
+// By default, float setters clamp out-of-range values and treat NaN as neutral.
+// In strict mode, they ignore calls with such values instead, and the next
+// Update returns an *InputRangeError describing the first one without sending
+// the report, so that a frame with a rejected input is never sent. The error
+// waits for that Update even if the report is sent in the background meanwhile
+// (timed actions, turbo...), which only sends the inputs that were accepted.
+func (g *BaseGamepad) SetStrictInput(strict bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.strict = strict
+	g.inputErr = nil
+}
+
+// checkInput validates the values given to a float setter, returning false if the call
+// must be ignored, i.e. in strict mode with a value outside of [min, max]
+func (g *BaseGamepad) checkInput(setter string, min, max float64, values ...float64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.strict {
+		return true
+	}
+	for _, value := range values {
+		if !(value >= min && value <= max) {
+			if g.inputErr == nil {
+				g.inputErr = &InputRangeError{Setter: setter, Value: value, Min: min, Max: max}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// takeInputError returns and clears the error recorded in strict mode (g.mu must be held)
+func (g *BaseGamepad) takeInputError() error {
+	err := g.inputErr
+	g.inputErr = nil
+	return err
+}
+
+// clampFloat clamps value to [min, max], treating NaN as 0 (neutral)
+func clampFloat(value, min, max float64) float64 {
+	if math.IsNaN(value) {
+		return 0
+	}
+	return math.Max(min, math.Min(max, value))
+}
@@ -0,0 +1,78 @@
+package vgamepad
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestClampedFloatSetters(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.LeftJoystickFloat(1.5, -7)
+	g.RightJoystickFloat(math.NaN(), math.Inf(1))
+	g.LeftTriggerFloat(-0.5)
+	g.RightTriggerFloat(math.Inf(1))
+
+	r := g.GetReport()
+	if r.SThumbLX != 32767 || r.SThumbLY != -32767 {
+		t.Errorf("left joystick (1.5, -7) = %d, %d, want the edges instead of wrapping around", r.SThumbLX, r.SThumbLY)
+	}
+	if r.SThumbRX != 0 || r.SThumbRY != 32767 {
+		t.Errorf("right joystick (NaN, +Inf) = %d, %d, want 0, 32767", r.SThumbRX, r.SThumbRY)
+	}
+	if r.BLeftTrigger != 0 || r.BRightTrigger != 255 {
+		t.Errorf("triggers (-0.5, +Inf) = %d, %d, want 0, 255", r.BLeftTrigger, r.BRightTrigger)
+	}
+}
+
+func TestStrictInput(t *testing.T) {
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+	g.SetStrictInput(true)
+
+	g.LeftJoystickFloat(0.5, 0)
+	g.RightTriggerFloat(1.2)
+	g.LeftJoystickFloat(0, math.NaN())
+	g.LeftTriggerFloat(1) // Valid, but the frame is already rejected
+
+	// Rejected calls leave the report as it was
+	if r := g.GetReport(); r.BTriggerR != 0 || r.BThumbLY != 128 {
+		t.Errorf("rejected calls changed the report: right trigger %d, left Y %d", r.BTriggerR, r.BThumbLY)
+	}
+
+	// Update reports the first rejected value and does not send the frame (no device is needed to return)
+	err := g.Update()
+	var rangeErr *InputRangeError
+	if !errors.As(err, &rangeErr) {
+		t.Fatalf("Update() = %v, want an *InputRangeError", err)
+	}
+	if rangeErr.Setter != "RightTriggerFloat" || rangeErr.Value != 1.2 || rangeErr.Min != 0 || rangeErr.Max != 1 {
+		t.Errorf("Update() = %+v, want the rejected right trigger value", rangeErr)
+	}
+
+	// The error is reported once
+	g.mu.Lock()
+	pending := g.takeInputError()
+	g.mu.Unlock()
+	if pending != nil {
+		t.Errorf("error still pending after Update: %v", pending)
+	}
+
+	// Values on the edges are valid
+	g.LeftJoystickFloat(-1, 1)
+	g.mu.Lock()
+	pending = g.takeInputError()
+	g.mu.Unlock()
+	if pending != nil {
+		t.Errorf("(-1, 1) was rejected: %v", pending)
+	}
+
+	// Leaving strict mode drops the pending error
+	g.RightJoystickFloat(2, 0)
+	g.SetStrictInput(false)
+	g.mu.Lock()
+	pending = g.takeInputError()
+	g.mu.Unlock()
+	if pending != nil {
+		t.Errorf("error still pending after SetStrictInput(false): %v", pending)
+	}
+}
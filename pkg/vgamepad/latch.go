@@ -0,0 +1,252 @@
+package vgamepad
+
+import (
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// LatchMode selects how a button reacts to PressButton and ReleaseButton, for accessibility
+type LatchMode int
+
+const (
+	LatchNone   LatchMode = iota // The button follows PressButton and ReleaseButton
+	LatchToggle                  // A press latches the button, the next press releases it
+	LatchSticky                  // The button stays pressed for Latch.Duration after being released
+	LatchHold                    // Holding the button for Latch.Duration latches it, the next press releases it
+)
+
+// Latch configures the latch mode of a button
+type Latch struct {
+	Mode     LatchMode
+	Duration time.Duration // How long the button stays pressed (LatchSticky) or must be held (LatchHold)
+}
+
+// latchState is the runtime state of a button with a latch mode
+type latchState struct {
+	latch   Latch
+	set     func(mask uint16, pressed bool) // Writes the button to the report (g.mu must be held)
+	update  func() error
+	down    bool        // Whether the button is held, i.e. pressed and not released
+	latched bool        // Whether the button stays pressed without being held
+	timer   *time.Timer // Pending end of the sticky time or of the hold time
+}
+
+// stop cancels the pending timer of the latch
+func (s *latchState) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// setLatch sets the latch mode of each button of mask (LatchNone removes it).
+// set writes buttons of that kind to the report, update sends it.
+func (g *BaseGamepad) setLatch(kind controlKind, mask uint16, latch Latch, set func(mask uint16, pressed bool), update func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for bit := uint16(1); bit != 0; bit <<= 1 {
+		if mask&bit == 0 {
+			continue
+		}
+		c := control{kind: kind, mask: bit}
+		if s, ok := g.latches[c]; ok {
+			s.stop()
+			if s.latched && !s.down {
+				set(bit, false)
+			}
+			delete(g.latches, c)
+		}
+		if latch.Mode == LatchNone {
+			continue
+		}
+		if g.latches == nil {
+			g.latches = make(map[control]*latchState)
+		}
+		g.latches[c] = &latchState{latch: latch, set: set, update: update}
+	}
+}
+
+// afterLatch runs f with g.mu held after d, unless the latch has been stopped or removed in the meantime
+func (g *BaseGamepad) afterLatch(c control, s *latchState, d time.Duration, f func()) {
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if g.latches[c] != s || s.timer != timer {
+			return
+		}
+		s.timer = nil
+		f()
+	})
+	s.timer = timer
+}
+
+// pressLatched presses the buttons of mask that have a latch mode, and returns the others (g.mu must be held)
+func (g *BaseGamepad) pressLatched(kind controlKind, mask uint16) uint16 {
+	for c, s := range g.latches {
+		if c.kind != kind || mask&c.mask == 0 {
+			continue
+		}
+		mask &^= c.mask
+		if s.down {
+			continue
+		}
+		s.down = true
+		s.stop()
+
+		switch s.latch.Mode {
+		case LatchToggle:
+			s.latched = !s.latched
+			s.set(c.mask, s.latched)
+		case LatchSticky:
+			s.latched = false
+			s.set(c.mask, true)
+		case LatchHold:
+			s.set(c.mask, true)
+			if s.latched {
+				s.latched = false
+				break
+			}
+			s := s
+			g.afterLatch(c, s, s.latch.Duration, func() {
+				s.latched = s.down
+			})
+		}
+	}
+	return mask
+}
+
+// releaseLatched releases the buttons of mask that have a latch mode, and returns the others (g.mu must be held)
+func (g *BaseGamepad) releaseLatched(kind controlKind, mask uint16) uint16 {
+	for c, s := range g.latches {
+		if c.kind != kind || mask&c.mask == 0 {
+			continue
+		}
+		mask &^= c.mask
+		if !s.down {
+			continue
+		}
+		s.down = false
+		s.stop()
+
+		switch s.latch.Mode {
+		case LatchSticky:
+			s.latched = true
+			c, s := c, s
+			g.afterLatch(c, s, s.latch.Duration, func() {
+				s.latched = false
+				s.set(c.mask, false)
+				if g.devicep != 0 {
+					s.update()
+				}
+			})
+		case LatchHold:
+			if !s.latched {
+				s.set(c.mask, false)
+			}
+		}
+	}
+	return mask
+}
+
+// latched returns the latched buttons of a kind
+func (g *BaseGamepad) latched(kind controlKind) uint16 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var mask uint16
+	for c, s := range g.latches {
+		if c.kind == kind && s.latched {
+			mask |= c.mask
+		}
+	}
+	return mask
+}
+
+// ReleaseLatched releases every latched button that is not held. Call Update to send the report.
+func (g *BaseGamepad) ReleaseLatched() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for c, s := range g.latches {
+		if !s.latched {
+			continue
+		}
+		s.latched = false
+		s.stop()
+		if !s.down {
+			s.set(c.mask, false)
+		}
+	}
+}
+
+// resetLatches forgets the state of the latches, whose buttons are released by a reset (g.mu must be held)
+func (g *BaseGamepad) resetLatches() {
+	for _, s := range g.latches {
+		s.stop()
+		s.down = false
+		s.latched = false
+	}
+}
+
+// setButtons presses or releases buttons in the report (g.mu must be held)
+func (g *VX360Gamepad) setButtons(mask uint16, pressed bool) {
+	if pressed {
+		g.report.WButtons |= mask
+	} else {
+		g.report.WButtons &^= mask
+	}
+	g.noteDPad(g.report.WButtons)
+}
+
+// SetLatch sets the latch mode of buttons, applied by PressButton and ReleaseButton (Latch{} removes it)
+func (g *VX360Gamepad) SetLatch(button commons.XUSBButton, latch Latch) {
+	g.setLatch(controlButton, uint16(button), latch, g.setButtons, g.update)
+}
+
+// LatchedButtons returns the buttons that stay pressed because of their latch mode
+func (g *VX360Gamepad) LatchedButtons() commons.XUSBButton {
+	return commons.XUSBButton(g.latched(controlButton))
+}
+
+// setButtons presses or releases buttons in the report (g.mu must be held)
+func (g *VDS4Gamepad) setButtons(mask uint16, pressed bool) {
+	if pressed {
+		g.report.WButtons |= mask
+	} else {
+		g.report.WButtons &^= mask
+	}
+}
+
+// setSpecialButtons presses or releases special buttons in the report (g.mu must be held)
+func (g *VDS4Gamepad) setSpecialButtons(mask uint16, pressed bool) {
+	if pressed {
+		g.report.BSpecial |= uint8(mask)
+	} else {
+		g.report.BSpecial &^= uint8(mask)
+	}
+}
+
+// SetLatch sets the latch mode of buttons, applied by PressButton and ReleaseButton (Latch{} removes it)
+func (g *VDS4Gamepad) SetLatch(button commons.DS4Button, latch Latch) {
+	g.setLatch(controlButton, uint16(button), latch, g.setButtons, g.update)
+}
+
+// SetSpecialLatch sets the latch mode of special buttons, applied by PressSpecialButton and
+// ReleaseSpecialButton (Latch{} removes it)
+func (g *VDS4Gamepad) SetSpecialLatch(specialButton commons.DS4SpecialButton, latch Latch) {
+	g.setLatch(controlSpecialButton, uint16(specialButton), latch, g.setSpecialButtons, g.update)
+}
+
+// LatchedButtons returns the buttons that stay pressed because of their latch mode
+func (g *VDS4Gamepad) LatchedButtons() commons.DS4Button {
+	return commons.DS4Button(g.latched(controlButton))
+}
+
+// LatchedSpecialButtons returns the special buttons that stay pressed because of their latch mode
+func (g *VDS4Gamepad) LatchedSpecialButtons() commons.DS4SpecialButton {
+	return commons.DS4SpecialButton(g.latched(controlSpecialButton))
+}
@@ -0,0 +1,168 @@
+package vgamepad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// pressed reports whether the buttons are pressed in the report of the gamepad
+func pressed(g *VX360Gamepad, button commons.XUSBButton) bool {
+	return g.GetReport().WButtons&uint16(button) != 0
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestLatchToggle(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.SetLatch(commons.XUSB_GAMEPAD_A, Latch{Mode: LatchToggle})
+
+	// Only A latches, B pressed along with it follows the calls
+	g.PressButton(commons.XUSB_GAMEPAD_A | commons.XUSB_GAMEPAD_B)
+	g.ReleaseButton(commons.XUSB_GAMEPAD_A | commons.XUSB_GAMEPAD_B)
+	if !pressed(g, commons.XUSB_GAMEPAD_A) || pressed(g, commons.XUSB_GAMEPAD_B) {
+		t.Errorf("after a tap: buttons %#x, want A latched only", g.GetReport().WButtons)
+	}
+	if l := g.LatchedButtons(); l != commons.XUSB_GAMEPAD_A {
+		t.Errorf("LatchedButtons() = %#x", l)
+	}
+
+	// Pressing again without a release in between is not a second tap
+	g.PressButton(commons.XUSB_GAMEPAD_A)
+	g.PressButton(commons.XUSB_GAMEPAD_A)
+	if pressed(g, commons.XUSB_GAMEPAD_A) {
+		t.Error("A still pressed on the second tap")
+	}
+	g.ReleaseButton(commons.XUSB_GAMEPAD_A)
+	if pressed(g, commons.XUSB_GAMEPAD_A) || g.LatchedButtons() != 0 {
+		t.Error("A pressed again by the release")
+	}
+}
+
+func TestLatchSticky(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.SetLatch(commons.XUSB_GAMEPAD_X, Latch{Mode: LatchSticky, Duration: 30 * time.Millisecond})
+
+	g.PressButton(commons.XUSB_GAMEPAD_X)
+	g.ReleaseButton(commons.XUSB_GAMEPAD_X)
+	if !pressed(g, commons.XUSB_GAMEPAD_X) {
+		t.Fatal("X released right away")
+	}
+
+	// Pressing again within the sticky time cancels it: X stays pressed as long as it is held
+	g.PressButton(commons.XUSB_GAMEPAD_X)
+	time.Sleep(60 * time.Millisecond)
+	if !pressed(g, commons.XUSB_GAMEPAD_X) || g.LatchedButtons() != 0 {
+		t.Fatal("X released while held")
+	}
+
+	// And the sticky time starts over from the last release
+	g.ReleaseButton(commons.XUSB_GAMEPAD_X)
+	start := time.Now()
+	waitFor(t, "the end of the sticky time", func() bool { return !pressed(g, commons.XUSB_GAMEPAD_X) })
+	if d := time.Since(start); d < 25*time.Millisecond {
+		t.Errorf("X released %v after the release, want about 30ms", d)
+	}
+}
+
+func TestLatchHold(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.SetLatch(commons.XUSB_GAMEPAD_Y, Latch{Mode: LatchHold, Duration: 20 * time.Millisecond})
+
+	// A short press is a normal press
+	g.PressButton(commons.XUSB_GAMEPAD_Y)
+	g.ReleaseButton(commons.XUSB_GAMEPAD_Y)
+	if pressed(g, commons.XUSB_GAMEPAD_Y) {
+		t.Error("Y latched by a short press")
+	}
+	// The hold timer of the short press does not latch a later press
+	time.Sleep(30 * time.Millisecond)
+	if g.LatchedButtons() != 0 {
+		t.Error("Y latched after a short press")
+	}
+
+	// Held long enough, it latches
+	g.PressButton(commons.XUSB_GAMEPAD_Y)
+	waitFor(t, "the hold time", func() bool { return g.LatchedButtons() == commons.XUSB_GAMEPAD_Y })
+	g.ReleaseButton(commons.XUSB_GAMEPAD_Y)
+	if !pressed(g, commons.XUSB_GAMEPAD_Y) {
+		t.Fatal("Y released after being held")
+	}
+
+	// The next press releases it on release, without latching again
+	g.PressButton(commons.XUSB_GAMEPAD_Y)
+	if g.LatchedButtons() != 0 || !pressed(g, commons.XUSB_GAMEPAD_Y) {
+		t.Error("Y not held by the unlatching press")
+	}
+	g.ReleaseButton(commons.XUSB_GAMEPAD_Y)
+	if pressed(g, commons.XUSB_GAMEPAD_Y) {
+		t.Error("Y still pressed after unlatching")
+	}
+}
+
+func TestReleaseLatched(t *testing.T) {
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+	g.SetLatch(commons.DS4_BUTTON_CIRCLE|commons.DS4_BUTTON_SQUARE, Latch{Mode: LatchToggle})
+	g.SetSpecialLatch(commons.DS4_SPECIAL_BUTTON_PS, Latch{Mode: LatchToggle})
+
+	g.PressButton(commons.DS4_BUTTON_CIRCLE | commons.DS4_BUTTON_SQUARE)
+	g.ReleaseButton(commons.DS4_BUTTON_CIRCLE)
+	g.PressSpecialButton(commons.DS4_SPECIAL_BUTTON_PS)
+	g.ReleaseSpecialButton(commons.DS4_SPECIAL_BUTTON_PS)
+	if g.LatchedSpecialButtons() != commons.DS4_SPECIAL_BUTTON_PS {
+		t.Fatalf("LatchedSpecialButtons() = %#x", g.LatchedSpecialButtons())
+	}
+
+	// Every latch is cleared, but a held button stays pressed until released
+	g.ReleaseLatched()
+	r := g.GetReport()
+	if r.WButtons&uint16(commons.DS4_BUTTON_CIRCLE) != 0 || r.BSpecial != 0 {
+		t.Errorf("latched buttons still pressed: %#x, special %#x", r.WButtons, r.BSpecial)
+	}
+	if r.WButtons&uint16(commons.DS4_BUTTON_SQUARE) == 0 {
+		t.Error("held square released")
+	}
+	if g.LatchedButtons() != 0 {
+		t.Errorf("LatchedButtons() = %#x after ReleaseLatched", g.LatchedButtons())
+	}
+}
+
+func TestRemoveLatch(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.SetLatch(commons.XUSB_GAMEPAD_START|commons.XUSB_GAMEPAD_BACK, Latch{Mode: LatchToggle})
+	g.PressButton(commons.XUSB_GAMEPAD_START | commons.XUSB_GAMEPAD_BACK)
+	g.ReleaseButton(commons.XUSB_GAMEPAD_START)
+
+	// Removing the latch releases a latched button, but not a held one
+	g.SetLatch(commons.XUSB_GAMEPAD_START|commons.XUSB_GAMEPAD_BACK, Latch{})
+	if pressed(g, commons.XUSB_GAMEPAD_START) || !pressed(g, commons.XUSB_GAMEPAD_BACK) {
+		t.Errorf("after removing the latches: %#x, want only back", g.GetReport().WButtons)
+	}
+	// Back is a plain button again
+	g.ReleaseButton(commons.XUSB_GAMEPAD_BACK)
+	g.PressButton(commons.XUSB_GAMEPAD_START)
+	g.ReleaseButton(commons.XUSB_GAMEPAD_START)
+	if g.GetReport().WButtons != 0 {
+		t.Errorf("plain buttons = %#x", g.GetReport().WButtons)
+	}
+
+	// Reset forgets the state, so the next tap latches from scratch
+	g.SetLatch(commons.XUSB_GAMEPAD_START, Latch{Mode: LatchToggle})
+	g.PressButton(commons.XUSB_GAMEPAD_START)
+	g.mu.Lock()
+	g.reset()
+	g.mu.Unlock()
+	g.PressButton(commons.XUSB_GAMEPAD_START)
+	if !pressed(g, commons.XUSB_GAMEPAD_START) {
+		t.Error("first tap after a reset did not latch")
+	}
+}
@@ -0,0 +1,290 @@
+package vgamepad
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// mirrorQueueSize is the number of delayed reports a mirror target can have pending
+const mirrorQueueSize = 1024
+
+// MirrorTarget is a gamepad driven by a Mirror
+type MirrorTarget struct {
+	Controller Controller
+
+	// Delay is how long after Update the inputs reach this gamepad
+	Delay time.Duration
+
+	// Offsets are added to the axis values sent to this gamepad, indexed by Axis,
+	// so that the gamepads do not all receive exactly the same values. Axes at rest
+	// are left at rest, and an offset never pushes a value past rest or out of range.
+	Offsets [axisCount]float64
+}
+
+// MirrorError is returned by Mirror.Update when some of the gamepads failed to update;
+// the other gamepads were updated anyway
+type MirrorError struct {
+	Errors map[int]error // Error of each failed target, by index
+}
+
+// Error returns a string representation of the MirrorError
+func (e *MirrorError) Error() string {
+	first := -1
+	for i := range e.Errors {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	if first < 0 {
+		return "mirror targets failed to update"
+	}
+	return fmt.Sprintf("%d mirror target(s) failed to update, first is target %d: %v", len(e.Errors), first, e.Errors[first])
+}
+
+// Unwrap returns the errors of the failed targets
+func (e *MirrorError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// mirrorState is the state of the inputs of a mirror
+type mirrorState struct {
+	buttons Button
+	dpad    commons.DS4DPadDirection
+	axes    [axisCount]float64
+}
+
+// neutralMirrorState returns the state of a mirror without any input
+func neutralMirrorState() mirrorState {
+	return mirrorState{dpad: commons.DS4_BUTTON_DPAD_NONE}
+}
+
+// mirrorFrame is a state to send to a delayed target
+type mirrorFrame struct {
+	state mirrorState
+	due   time.Time
+}
+
+// mirrorTarget is the runtime state of a target of a mirror
+type mirrorTarget struct {
+	MirrorTarget
+	applied mirrorState      // State last set on the gamepad
+	queue   chan mirrorFrame // Pending states, for delayed targets
+}
+
+// Mirror drives several gamepads, of any type, with the same inputs.
+// Inputs are set on the mirror, and sent to every gamepad by Update.
+type Mirror struct {
+	mu      sync.Mutex
+	state   mirrorState
+	targets []*mirrorTarget
+	onError func(target int, err error)
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewMirror creates a Mirror driving the given gamepads
+func NewMirror(targets ...MirrorTarget) *Mirror {
+	m := &Mirror{state: neutralMirrorState()}
+	for i, t := range targets {
+		target := &mirrorTarget{MirrorTarget: t, applied: neutralMirrorState()}
+		if t.Delay > 0 {
+			target.queue = make(chan mirrorFrame, mirrorQueueSize)
+			m.wg.Add(1)
+			go m.delayLoop(i, target)
+		}
+		m.targets = append(m.targets, target)
+	}
+	return m
+}
+
+// SetErrorHandler sets a function called when a delayed gamepad fails to update,
+// as these errors cannot be returned by Update
+func (m *Mirror) SetErrorHandler(handler func(target int, err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onError = handler
+}
+
+// Press presses standard buttons (no effect if already pressed)
+func (m *Mirror) Press(button Button) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.buttons |= button
+}
+
+// Release releases standard buttons (no effect if already released)
+func (m *Mirror) Release(button Button) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.buttons &^= button
+}
+
+// LeftTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the left trigger
+func (m *Mirror) LeftTriggerFloat(valueFloat float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.axes[AxisLeftTrigger] = valueFloat
+}
+
+// RightTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the right trigger
+func (m *Mirror) RightTriggerFloat(valueFloat float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.axes[AxisRightTrigger] = valueFloat
+}
+
+// LeftJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the left joystick
+func (m *Mirror) LeftJoystickFloat(xValueFloat, yValueFloat float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.axes[AxisLeftX], m.state.axes[AxisLeftY] = xValueFloat, yValueFloat
+}
+
+// RightJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the right joystick
+func (m *Mirror) RightJoystickFloat(xValueFloat, yValueFloat float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.axes[AxisRightX], m.state.axes[AxisRightY] = xValueFloat, yValueFloat
+}
+
+// DirectionalPad sets the direction of the directional pad (hat)
+func (m *Mirror) DirectionalPad(direction commons.DS4DPadDirection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.dpad = direction
+}
+
+// Reset releases all the inputs of the mirror. Call Update to send them.
+func (m *Mirror) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = neutralMirrorState()
+}
+
+// Update sends the inputs to every gamepad. A failing gamepad does not prevent the others
+// from being updated: the failures are returned together as a *MirrorError.
+// Delayed gamepads are updated later, and their failures go to the error handler.
+func (m *Mirror) Update() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("the mirror is closed")
+	}
+	errs := make(map[int]error)
+	now := time.Now()
+	for i, t := range m.targets {
+		if t.queue == nil {
+			if err := t.send(m.state); err != nil {
+				errs[i] = err
+			}
+			continue
+		}
+		select {
+		case t.queue <- mirrorFrame{state: m.state, due: now.Add(t.Delay)}:
+		default:
+			errs[i] = fmt.Errorf("too many delayed reports pending, report dropped")
+		}
+	}
+	if len(errs) > 0 {
+		return &MirrorError{Errors: errs}
+	}
+	return nil
+}
+
+// Close stops sending delayed reports, once the pending ones are sent. The gamepads are not closed.
+func (m *Mirror) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		for _, t := range m.targets {
+			if t.queue != nil {
+				close(t.queue)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+// delayLoop sends the reports of a delayed target when they are due
+func (m *Mirror) delayLoop(index int, t *mirrorTarget) {
+	defer m.wg.Done()
+
+	for frame := range t.queue {
+		time.Sleep(time.Until(frame.due))
+		if err := t.send(frame.state); err != nil {
+			m.mu.Lock()
+			handler := m.onError
+			m.mu.Unlock()
+			if handler != nil {
+				handler(index, err)
+			}
+		}
+	}
+}
+
+// offsetAxis adds an offset to an axis value that is not at rest, without crossing rest
+// and clamped to the range of the axis
+func offsetAxis(axis Axis, value, offset float64) float64 {
+	if value == 0 || offset == 0 {
+		return value
+	}
+	shifted := value + offset
+	if (shifted > 0) != (value > 0) {
+		return 0
+	}
+	if axis.isTrigger() {
+		return clampFloat(shifted, 0, 1)
+	}
+	return clampFloat(shifted, -1, 1)
+}
+
+// send sets the changes of a state on the gamepad of the target, with its offsets, and updates it
+func (t *mirrorTarget) send(state mirrorState) error {
+	c := t.Controller
+	for axis := range state.axes {
+		state.axes[axis] = offsetAxis(Axis(axis), state.axes[axis], t.Offsets[axis])
+	}
+
+	if pressed := state.buttons &^ t.applied.buttons; pressed != 0 {
+		c.Press(pressed)
+	}
+	if released := t.applied.buttons &^ state.buttons; released != 0 {
+		c.Release(released)
+	}
+	if state.dpad != t.applied.dpad {
+		c.DirectionalPad(state.dpad)
+	}
+	if state.axes[AxisLeftTrigger] != t.applied.axes[AxisLeftTrigger] {
+		c.LeftTriggerFloat(state.axes[AxisLeftTrigger])
+	}
+	if state.axes[AxisRightTrigger] != t.applied.axes[AxisRightTrigger] {
+		c.RightTriggerFloat(state.axes[AxisRightTrigger])
+	}
+	if state.axes[AxisLeftX] != t.applied.axes[AxisLeftX] || state.axes[AxisLeftY] != t.applied.axes[AxisLeftY] {
+		c.LeftJoystickFloat(state.axes[AxisLeftX], state.axes[AxisLeftY])
+	}
+	if state.axes[AxisRightX] != t.applied.axes[AxisRightX] || state.axes[AxisRightY] != t.applied.axes[AxisRightY] {
+		c.RightJoystickFloat(state.axes[AxisRightX], state.axes[AxisRightY])
+	}
+	t.applied = state
+	return c.Update()
+}
@@ -0,0 +1,138 @@
+package vgamepad
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// updatingController is a fakeController that also takes D-pad directions and updates
+type updatingController struct {
+	fakeController
+	dpad      commons.DS4DPadDirection
+	updates   []time.Time // When Update was called
+	updateErr error       // Returned by Update
+}
+
+func (f *updatingController) DirectionalPad(direction commons.DS4DPadDirection) {
+	f.dpad = direction
+	f.record("DirectionalPad(%v)", direction)
+}
+
+func (f *updatingController) Update() error {
+	f.updates = append(f.updates, time.Now())
+	return f.updateErr
+}
+
+func TestMirrorFanOut(t *testing.T) {
+	a, b := &updatingController{}, &updatingController{}
+	m := NewMirror(MirrorTarget{Controller: a}, MirrorTarget{Controller: b})
+	defer m.Close()
+
+	// Nothing reaches the gamepads before Update
+	m.Press(ButtonSouth | ButtonEast)
+	m.LeftJoystickFloat(0.5, -0.5)
+	if len(a.calls) != 0 {
+		t.Fatalf("calls before Update: %q", a.calls)
+	}
+	if err := m.Update(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []*updatingController{a, b} {
+		if f.buttons != ButtonSouth|ButtonEast || f.axes[AxisLeftX] != 0.5 || len(f.updates) != 1 {
+			t.Errorf("target = %v, %v, %d updates", f.buttons, f.axes, len(f.updates))
+		}
+	}
+
+	// Only the changes are set again; the D-pad starts neutral
+	a.calls = nil
+	m.Release(ButtonEast)
+	m.DirectionalPad(commons.DS4_BUTTON_DPAD_WEST)
+	m.Update()
+	if want := []string{"Release(east)", "DirectionalPad(6)"}; strings.Join(a.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %q, want %q", a.calls, want)
+	}
+
+	// Reset puts everything at rest
+	m.Reset()
+	m.Update()
+	if b.buttons != 0 || b.axes != [axisCount]float64{} || b.dpad != commons.DS4_BUTTON_DPAD_NONE {
+		t.Errorf("after Reset: %v, %v, %v", b.buttons, b.axes, b.dpad)
+	}
+}
+
+func TestOffsetAxis(t *testing.T) {
+	for _, tt := range []struct {
+		axis                Axis
+		value, offset, want float64
+	}{
+		{AxisLeftX, 0, 0.1, 0},       // At rest stays at rest
+		{AxisLeftX, 0.5, 0.1, 0.6},   // Pushed further
+		{AxisLeftX, -0.5, 0.1, -0.4}, // Pulled back toward rest
+		{AxisLeftX, 0.05, -0.1, 0},   // But never past it
+		{AxisRightY, 0.95, 0.1, 1},   // Clamped to the range
+		{AxisRightY, -0.95, -0.1, -1},
+		{AxisLeftTrigger, 0.2, -0.3, 0}, // A trigger does not go below released
+		{AxisRightTrigger, 0.95, 0.1, 1},
+		{AxisRightTrigger, 0.5, 0, 0.5}, // No offset
+	} {
+		if got := offsetAxis(tt.axis, tt.value, tt.offset); !approx(got, tt.want) {
+			t.Errorf("offsetAxis(%v, %v, %v) = %v, want %v", tt.axis, tt.value, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestMirrorPartialFailure(t *testing.T) {
+	broken := errors.New("unplugged")
+	a, b, c := &updatingController{}, &updatingController{updateErr: broken}, &updatingController{}
+	m := NewMirror(MirrorTarget{Controller: a}, MirrorTarget{Controller: b}, MirrorTarget{Controller: c, Offsets: [axisCount]float64{AxisRightTrigger: -0.1}})
+	defer m.Close()
+
+	m.RightTriggerFloat(0.5)
+	err := m.Update()
+	var mirrorErr *MirrorError
+	if !errors.As(err, &mirrorErr) || len(mirrorErr.Errors) != 1 || mirrorErr.Errors[1] != broken {
+		t.Fatalf("Update() = %v, want target 1 failing alone", err)
+	}
+	if !errors.Is(err, broken) || !strings.Contains(err.Error(), "target 1: unplugged") {
+		t.Errorf("Update() = %q, want the cause reachable and named", err)
+	}
+	// The targets after the failing one are updated anyway, with their own offsets
+	if len(c.updates) != 1 || !approx(c.axes[AxisRightTrigger], 0.4) {
+		t.Errorf("last target: %d updates, trigger %v", len(c.updates), c.axes[AxisRightTrigger])
+	}
+}
+
+func TestMirrorDelay(t *testing.T) {
+	late := &updatingController{updateErr: errors.New("late failure")}
+	m := NewMirror(MirrorTarget{Controller: &updatingController{}}, MirrorTarget{Controller: late, Delay: 30 * time.Millisecond})
+	failures := make(chan int, 10)
+	m.SetErrorHandler(func(target int, err error) { failures <- target })
+
+	start := time.Now()
+	m.Press(ButtonNorth)
+	if err := m.Update(); err != nil {
+		t.Fatalf("Update() = %v, delayed failures are not returned", err)
+	}
+	m.Release(ButtonNorth)
+	m.Update()
+
+	// Close waits for the pending reports, sent in order and not before their delay
+	m.Close()
+	if len(late.updates) != 2 || late.updates[0].Sub(start) < 30*time.Millisecond {
+		t.Fatalf("delayed target: updates %v after the start", late.updates)
+	}
+	if got := strings.Join(late.calls, ","); got != "Press(north),Release(north)" {
+		t.Errorf("delayed calls = %s", got)
+	}
+	if len(failures) != 2 || <-failures != 1 {
+		t.Errorf("error handler called %d times", len(failures))
+	}
+
+	if err := m.Update(); err == nil {
+		t.Error("Update() after Close succeeded")
+	}
+}
@@ -0,0 +1,356 @@
+package vgamepad
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// MixControl is a set of controls driven by an input source of a mixer
+type MixControl uint8
+
+const (
+	MixButtons       MixControl = 1 << iota // Buttons and special buttons, D-pad excluded
+	MixDPad                                 // Directional pad
+	MixLeftTrigger                          // Left trigger
+	MixRightTrigger                         // Right trigger
+	MixLeftJoystick                         // Both axes of the left joystick
+	MixRightJoystick                        // Both axes of the right joystick
+
+	MixAll = MixButtons | MixDPad | MixLeftTrigger | MixRightTrigger | MixLeftJoystick | MixRightJoystick
+)
+
+// mixControls lists every control, in bit order
+var mixControls = [...]MixControl{MixButtons, MixDPad, MixLeftTrigger, MixRightTrigger, MixLeftJoystick, MixRightJoystick}
+
+// MixPolicy selects how the values of several sources driving the same control are merged
+type MixPolicy int
+
+const (
+	// MixPriority gives each control to the source with the highest priority driving it
+	MixPriority MixPolicy = iota
+
+	// MixCombine presses the buttons pressed by any source (OR), and gives each joystick
+	// and trigger to the source pushing it the furthest (max magnitude)
+	MixCombine
+
+	// MixHumanOverride gives each control to the human source while it uses it and for
+	// MixerOptions.OverrideTimeout after, then to the other sources with MixPriority
+	MixHumanOverride
+)
+
+// MixerOptions configures a mixer
+type MixerOptions struct {
+	Policy          MixPolicy
+	Human           string        // Name of the human source, for MixHumanOverride
+	OverrideTimeout time.Duration // How long the human source keeps a control after releasing it, for MixHumanOverride
+}
+
+// mixState is a report in a form shared by all gamepad types
+type mixState struct {
+	buttons uint16           // Buttons, without the D-pad
+	special uint8            // Special buttons
+	dpad    uint16           // D-pad, as XUSB_GAMEPAD_DPAD_* bits
+	axes    [axisCount]int32 // Axes in report units, 0 being neutral
+}
+
+// neutral reports whether a control is at rest
+func (s *mixState) neutral(c MixControl) bool {
+	return s.magnitude(c) == 0
+}
+
+// magnitude returns how far a control is pushed, 0 at rest
+func (s *mixState) magnitude(c MixControl) float64 {
+	switch c {
+	case MixButtons:
+		return float64(s.buttons) + float64(s.special)
+	case MixDPad:
+		return float64(s.dpad)
+	case MixLeftTrigger:
+		return float64(s.axes[AxisLeftTrigger])
+	case MixRightTrigger:
+		return float64(s.axes[AxisRightTrigger])
+	case MixLeftJoystick:
+		return math.Hypot(float64(s.axes[AxisLeftX]), float64(s.axes[AxisLeftY]))
+	case MixRightJoystick:
+		return math.Hypot(float64(s.axes[AxisRightX]), float64(s.axes[AxisRightY]))
+	}
+	return 0
+}
+
+// copyControl copies a control from another state
+func (s *mixState) copyControl(c MixControl, from *mixState) {
+	switch c {
+	case MixButtons:
+		s.buttons, s.special = from.buttons, from.special
+	case MixDPad:
+		s.dpad = from.dpad
+	case MixLeftTrigger:
+		s.axes[AxisLeftTrigger] = from.axes[AxisLeftTrigger]
+	case MixRightTrigger:
+		s.axes[AxisRightTrigger] = from.axes[AxisRightTrigger]
+	case MixLeftJoystick:
+		s.axes[AxisLeftX], s.axes[AxisLeftY] = from.axes[AxisLeftX], from.axes[AxisLeftY]
+	case MixRightJoystick:
+		s.axes[AxisRightX], s.axes[AxisRightY] = from.axes[AxisRightX], from.axes[AxisRightY]
+	}
+}
+
+// orControl presses the buttons of a control pressed in another state
+func (s *mixState) orControl(c MixControl, from *mixState) {
+	switch c {
+	case MixButtons:
+		s.buttons |= from.buttons
+		s.special |= from.special
+	case MixDPad:
+		s.dpad |= from.dpad
+	}
+}
+
+// mixSource is an input source of a mixer
+type mixSource struct {
+	name       string
+	priority   int
+	controls   MixControl // Controls driven by the source, 0 until its first Set
+	state      mixState
+	lastActive [len(mixControls)]time.Time // When each control was last used, for MixHumanOverride
+}
+
+// Mixer contains common functionality for all mixer types: it merges the partial states of
+// several named input sources, e.g. a human and a bot, into the report of a gamepad
+type Mixer struct {
+	mu      sync.Mutex
+	options MixerOptions
+	sources []*mixSource // By decreasing priority
+	write   func(state mixState) error
+	timer   *time.Timer // Mixes again when a human override expires
+	closed  bool
+}
+
+// newMixer creates a Mixer writing the merged states with write
+func newMixer(options MixerOptions, write func(state mixState) error) *Mixer {
+	return &Mixer{options: options, write: write}
+}
+
+// AddSource adds an input source. Higher priorities win with MixPriority.
+func (m *Mixer) AddSource(name string, priority int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.source(name) != nil {
+		return fmt.Errorf("source %q already exists", name)
+	}
+	m.sources = append(m.sources, &mixSource{name: name, priority: priority})
+	sort.SliceStable(m.sources, func(i, j int) bool {
+		return m.sources[i].priority > m.sources[j].priority
+	})
+	return nil
+}
+
+// RemoveSource removes an input source, and updates the gamepad without it
+func (m *Mixer) RemoveSource(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sources {
+		if s.name == name {
+			m.sources = append(m.sources[:i], m.sources[i+1:]...)
+			return m.mix(time.Now())
+		}
+	}
+	return fmt.Errorf("unknown source %q", name)
+}
+
+// Close stops the mixer; the gamepad is left as it is
+func (m *Mixer) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
+// source returns the source with the given name, or nil (m.mu must be held)
+func (m *Mixer) source(name string) *mixSource {
+	for _, s := range m.sources {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// set replaces the state of the controls driven by a source, then updates the gamepad
+func (m *Mixer) set(name string, state mixState, controls MixControl) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("the mixer is closed")
+	}
+	s := m.source(name)
+	if s == nil {
+		return fmt.Errorf("unknown source %q", name)
+	}
+	now := time.Now()
+	for i, c := range mixControls {
+		if controls&c != 0 && (!state.neutral(c) || (s.controls&c != 0 && !s.state.neutral(c))) {
+			s.lastActive[i] = now
+		}
+	}
+	s.state = state
+	s.controls = controls
+	return m.mix(now)
+}
+
+// mix merges the states of the sources and writes them to the gamepad (m.mu must be held)
+func (m *Mixer) mix(now time.Time) error {
+	var out mixState
+	var expiry time.Time
+	for i, c := range mixControls {
+		if m.options.Policy == MixHumanOverride {
+			if human := m.source(m.options.Human); human != nil && human.controls&c != 0 {
+				until := human.lastActive[i].Add(m.options.OverrideTimeout)
+				if !human.state.neutral(c) || now.Before(until) {
+					out.copyControl(c, &human.state)
+					if human.state.neutral(c) && (expiry.IsZero() || until.Before(expiry)) {
+						expiry = until
+					}
+					continue
+				}
+			}
+		}
+
+		var best *mixSource
+		for _, s := range m.sources {
+			if s.controls&c == 0 || (m.options.Policy == MixHumanOverride && s.name == m.options.Human) {
+				continue
+			}
+			if m.options.Policy == MixCombine && (c == MixButtons || c == MixDPad) {
+				out.orControl(c, &s.state)
+				continue
+			}
+			if best == nil || (m.options.Policy == MixCombine && s.state.magnitude(c) > best.state.magnitude(c)) {
+				best = s
+			}
+		}
+		if best != nil {
+			out.copyControl(c, &best.state)
+		}
+	}
+
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	if !expiry.IsZero() {
+		m.timer = time.AfterFunc(time.Until(expiry), func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if !m.closed {
+				m.mix(time.Now())
+			}
+		})
+	}
+	return m.write(out)
+}
+
+// X360Mixer merges input sources into a VX360Gamepad
+type X360Mixer struct {
+	*Mixer
+}
+
+// NewX360Mixer creates a mixer driving a VX360Gamepad; each merge sets its report and calls Update.
+// Unlike SetReport, merges leave the controls of running timed actions (Tap, Pulse, HoldLeftTrigger, tweens...) to them.
+func NewX360Mixer(gamepad *VX360Gamepad, options MixerOptions) *X360Mixer {
+	return &X360Mixer{newMixer(options, func(state mixState) error {
+		gamepad.mergeReport(commons.XUSBReport{
+			WButtons:      state.buttons | state.dpad,
+			BLeftTrigger:  uint8(state.axes[AxisLeftTrigger]),
+			BRightTrigger: uint8(state.axes[AxisRightTrigger]),
+			SThumbLX:      int16(state.axes[AxisLeftX]),
+			SThumbLY:      int16(state.axes[AxisLeftY]),
+			SThumbRX:      int16(state.axes[AxisRightX]),
+			SThumbRY:      int16(state.axes[AxisRightY]),
+		})
+		return gamepad.Update()
+	})}
+}
+
+// Set replaces the state of the controls driven by a source with the values of report,
+// then merges all the sources and updates the gamepad
+func (m *X360Mixer) Set(source string, report commons.XUSBReport, controls MixControl) error {
+	dpad := uint16(commons.XUSB_GAMEPAD_DPAD)
+	return m.set(source, mixState{
+		buttons: report.WButtons &^ dpad,
+		dpad:    report.WButtons & dpad,
+		axes: [axisCount]int32{
+			AxisLeftX:        int32(report.SThumbLX),
+			AxisLeftY:        int32(report.SThumbLY),
+			AxisRightX:       int32(report.SThumbRX),
+			AxisRightY:       int32(report.SThumbRY),
+			AxisLeftTrigger:  int32(report.BLeftTrigger),
+			AxisRightTrigger: int32(report.BRightTrigger),
+		},
+	}, controls)
+}
+
+// DS4Mixer merges input sources into a VDS4Gamepad
+type DS4Mixer struct {
+	*Mixer
+}
+
+// NewDS4Mixer creates a mixer driving a VDS4Gamepad; each merge sets its report and calls Update.
+// Unlike SetReport, merges leave the controls of running timed actions (Tap, Pulse, HoldLeftTrigger, tweens...) to them.
+func NewDS4Mixer(gamepad *VDS4Gamepad, options MixerOptions) *DS4Mixer {
+	return &DS4Mixer{newMixer(options, func(state mixState) error {
+		buttons := state.buttons
+		if state.axes[AxisLeftTrigger] > 0 {
+			buttons |= uint16(commons.DS4_BUTTON_TRIGGER_LEFT)
+		}
+		if state.axes[AxisRightTrigger] > 0 {
+			buttons |= uint16(commons.DS4_BUTTON_TRIGGER_RIGHT)
+		}
+		report := commons.DS4Report{
+			BThumbLX:  uint8(state.axes[AxisLeftX] + 128),
+			BThumbLY:  uint8(state.axes[AxisLeftY] + 128),
+			BThumbRX:  uint8(state.axes[AxisRightX] + 128),
+			BThumbRY:  uint8(state.axes[AxisRightY] + 128),
+			WButtons:  buttons,
+			BSpecial:  state.special,
+			BTriggerL: uint8(state.axes[AxisLeftTrigger]),
+			BTriggerR: uint8(state.axes[AxisRightTrigger]),
+		}
+		commons.DS4SetDPad(&report, commons.XUSBToDS4DPad(commons.XUSBButton(state.dpad)))
+		gamepad.mergeReport(report)
+		return gamepad.Update()
+	})}
+}
+
+// Set replaces the state of the controls driven by a source with the values of report,
+// then merges all the sources and updates the gamepad. The digital trigger buttons
+// (DS4_BUTTON_TRIGGER_LEFT/RIGHT) are ignored: they follow the merged trigger values.
+func (m *DS4Mixer) Set(source string, report commons.DS4Report, controls MixControl) error {
+	triggers := uint16(commons.DS4_BUTTON_TRIGGER_LEFT | commons.DS4_BUTTON_TRIGGER_RIGHT)
+	return m.set(source, mixState{
+		buttons: report.WButtons &^ (0xF | triggers),
+		special: report.BSpecial,
+		dpad:    uint16(commons.DS4DPadToXUSB(commons.DS4DPadDirection(report.WButtons & 0xF))),
+		axes: [axisCount]int32{
+			AxisLeftX:        int32(report.BThumbLX) - 128,
+			AxisLeftY:        int32(report.BThumbLY) - 128,
+			AxisRightX:       int32(report.BThumbRX) - 128,
+			AxisRightY:       int32(report.BThumbRY) - 128,
+			AxisLeftTrigger:  int32(report.BTriggerL),
+			AxisRightTrigger: int32(report.BTriggerR),
+		},
+	}, controls)
+}
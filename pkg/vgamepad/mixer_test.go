@@ -0,0 +1,169 @@
+package vgamepad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// recordingMixer returns a mixer whose merged states are sent to a channel instead of a gamepad
+func recordingMixer(options MixerOptions, sources ...string) (*Mixer, chan mixState) {
+	written := make(chan mixState, 100)
+	m := newMixer(options, func(state mixState) error {
+		written <- state
+		return nil
+	})
+	for i, name := range sources {
+		m.AddSource(name, len(sources)-i) // First source, highest priority
+	}
+	return m, written
+}
+
+// last returns the last merged state written so far
+func last(t *testing.T, written chan mixState) mixState {
+	t.Helper()
+	var state mixState
+	for n := 0; ; n++ {
+		select {
+		case state = <-written:
+		default:
+			if n == 0 {
+				t.Fatal("nothing was written")
+			}
+			return state
+		}
+	}
+}
+
+func TestMixPriority(t *testing.T) {
+	m, written := recordingMixer(MixerOptions{}, "high", "low")
+
+	// Each control goes to the highest source driving it, even when that source leaves it at rest
+	m.set("low", mixState{buttons: 0x1, axes: [axisCount]int32{AxisLeftX: 100, AxisRightTrigger: 50}}, MixAll)
+	m.set("high", mixState{buttons: 0x2}, MixButtons|MixLeftJoystick)
+	got := last(t, written)
+	if got.buttons != 0x2 || got.axes[AxisLeftX] != 0 || got.axes[AxisRightTrigger] != 50 {
+		t.Errorf("merged = %+v, want high's buttons and neutral joystick, low's trigger", got)
+	}
+
+	// Removing a source hands its controls back
+	if err := m.RemoveSource("high"); err != nil {
+		t.Fatal(err)
+	}
+	if got := last(t, written); got.buttons != 0x1 || got.axes[AxisLeftX] != 100 {
+		t.Errorf("without high = %+v", got)
+	}
+}
+
+func TestMixCombine(t *testing.T) {
+	m, written := recordingMixer(MixerOptions{Policy: MixCombine}, "a", "b")
+
+	m.set("a", mixState{buttons: 0x1, dpad: uint16(dpadUp), axes: [axisCount]int32{AxisLeftX: 3000, AxisLeftY: 3000}}, MixAll)
+	m.set("b", mixState{buttons: 0x4, special: 0x1, dpad: uint16(dpadLeft), axes: [axisCount]int32{AxisLeftX: -4000}}, MixAll)
+	got := last(t, written)
+	if got.buttons != 0x5 || got.special != 0x1 || got.dpad != uint16(dpadUp|dpadLeft) {
+		t.Errorf("buttons = %#x, %#x, D-pad %#x, want every pressed button", got.buttons, got.special, got.dpad)
+	}
+	// The joystick pushed the furthest wins as a whole, both axes together (4243 > 4000)
+	if got.axes[AxisLeftX] != 3000 || got.axes[AxisLeftY] != 3000 {
+		t.Errorf("left joystick = %d, %d, want a's", got.axes[AxisLeftX], got.axes[AxisLeftY])
+	}
+}
+
+func TestMixHumanOverride(t *testing.T) {
+	m, written := recordingMixer(MixerOptions{Policy: MixHumanOverride, Human: "human", OverrideTimeout: 50 * time.Millisecond}, "bot", "human")
+	defer m.Close()
+
+	bot := mixState{axes: [axisCount]int32{AxisRightX: 1000}}
+	m.set("bot", bot, MixRightJoystick)
+	m.set("human", mixState{axes: [axisCount]int32{AxisRightX: -200}}, MixRightJoystick)
+	if got := last(t, written); got.axes[AxisRightX] != -200 {
+		t.Errorf("human active = %d, want the human's", got.axes[AxisRightX])
+	}
+
+	// Once released, the human keeps the joystick (at rest) for the timeout, then the bot gets it back by itself
+	m.set("human", mixState{}, MixRightJoystick)
+	if got := last(t, written); got.axes[AxisRightX] != 0 {
+		t.Errorf("human just released = %d, want neutral", got.axes[AxisRightX])
+	}
+	select {
+	case got := <-written:
+		if got.axes[AxisRightX] != 1000 {
+			t.Errorf("after the timeout = %d, want the bot's", got.axes[AxisRightX])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the override never expired")
+	}
+
+	// A human that never touched the joystick does not override it
+	m.set("human", mixState{}, MixRightJoystick)
+	if got := last(t, written); got.axes[AxisRightX] != 1000 {
+		t.Errorf("idle human = %d, want the bot's", got.axes[AxisRightX])
+	}
+}
+
+func TestMixerErrors(t *testing.T) {
+	m, _ := recordingMixer(MixerOptions{}, "a")
+	if err := m.AddSource("a", 5); err == nil {
+		t.Error("AddSource of a duplicate name succeeded")
+	}
+	if err := m.set("b", mixState{}, MixAll); err == nil {
+		t.Error("set of an unknown source succeeded")
+	}
+	if err := m.RemoveSource("b"); err == nil {
+		t.Error("RemoveSource of an unknown source succeeded")
+	}
+	m.Close()
+	if err := m.set("a", mixState{}, MixAll); err == nil {
+		t.Error("set after Close succeeded")
+	}
+}
+
+func TestMergeKeepsOwnedControls(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.report.BLeftTrigger = 200
+	g.report.WButtons = uint16(commons.XUSB_GAMEPAD_A)
+	tap := &TimedAction{control: control{kind: controlButton, mask: uint16(commons.XUSB_GAMEPAD_A)}, cancel: make(chan struct{})}
+	hold := &TimedAction{control: control{kind: controlLeftTrigger}, cancel: make(chan struct{})}
+	g.actions = map[*TimedAction]struct{}{tap: {}, hold: {}}
+
+	g.mergeReport(commons.XUSBReport{WButtons: uint16(commons.XUSB_GAMEPAD_B), BLeftTrigger: 10, BRightTrigger: 20})
+	r := g.GetReport()
+	if r.WButtons != uint16(commons.XUSB_GAMEPAD_A|commons.XUSB_GAMEPAD_B) || r.BLeftTrigger != 200 || r.BRightTrigger != 20 {
+		t.Errorf("merged report = %+v, want A and the left trigger kept", r)
+	}
+	if len(g.actions) != 2 || tap.cancelled() || hold.cancelled() {
+		t.Error("a merge cancelled the timed actions")
+	}
+
+	// SetReport still takes everything over
+	g.SetReport(commons.XUSBReport{})
+	if len(g.actions) != 0 || !tap.cancelled() {
+		t.Error("SetReport kept the timed actions")
+	}
+}
+
+func TestDS4MergeKeepsOwnedControls(t *testing.T) {
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+	g.DirectionalPad(commons.DS4_BUTTON_DPAD_NORTH)
+	g.RightTrigger(255)
+	g.actions = map[*TimedAction]struct{}{
+		{control: control{kind: controlButton, mask: 0xF}, cancel: make(chan struct{})}: {},
+		{control: control{kind: controlRightTrigger}, cancel: make(chan struct{})}:      {},
+	}
+
+	report := getDefaultDS4Report()
+	commons.DS4SetDPad(&report, commons.DS4_BUTTON_DPAD_SOUTH)
+	report.WButtons |= uint16(commons.DS4_BUTTON_CROSS)
+	report.BTriggerL = 30
+	g.mergeReport(report)
+
+	r := g.GetReport()
+	if dpad := commons.DS4DPadDirection(r.WButtons & 0xF); dpad != commons.DS4_BUTTON_DPAD_NORTH {
+		t.Errorf("D-pad = %v, want the owned north", dpad)
+	}
+	if r.WButtons&uint16(commons.DS4_BUTTON_CROSS) == 0 || r.BTriggerL != 30 || r.BTriggerR != 255 {
+		t.Errorf("merged report = %+v, want cross, left trigger 30 and the owned right trigger", r)
+	}
+}
@@ -0,0 +1,234 @@
+package vgamepad
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// Default values of MotionOptions
+const (
+	DefaultMotionFrameRate          = 60
+	DefaultMotionFramesPerDirection = 2
+	DefaultMotionChargeFrames       = 45
+	DefaultMotionButtonFrames       = 3
+)
+
+// MotionOptions configures how numpad notation is turned into frames.
+// Zero values fall back to the DefaultMotion* constants.
+type MotionOptions struct {
+	FrameRate          float64 // Frames per second of the frame clock
+	FramesPerDirection int     // Frames each direction is held
+	ChargeFrames       int     // Frames a charged direction ([4]) is held
+	ButtonFrames       int     // Frames the buttons are held
+	FacingLeft         bool    // Mirrors back (4) and forward (6) for a character facing left
+}
+
+// MotionStep is one step of a motion: a direction and buttons held for a number of frames
+type MotionStep struct {
+	Direction commons.DS4DPadDirection // D-pad direction, DS4_BUTTON_DPAD_NONE for neutral
+	Buttons   []string                 // Names of the buttons held, as written in the notation
+	Frames    int                      // Number of frames the step lasts
+}
+
+// Motion is a motion input ready to be performed on a gamepad
+type Motion struct {
+	FrameRate float64
+	Steps     []MotionStep
+}
+
+// Duration returns how long the motion takes to perform
+func (m Motion) Duration() time.Duration {
+	frames := 0
+	for _, step := range m.Steps {
+		frames += step.Frames
+	}
+	return time.Duration(float64(frames) * float64(time.Second) / m.FrameRate)
+}
+
+// numpadDirections maps numpad notation to D-pad directions, for a character facing right
+var numpadDirections = map[byte]commons.DS4DPadDirection{
+	'1': commons.DS4_BUTTON_DPAD_SOUTHWEST,
+	'2': commons.DS4_BUTTON_DPAD_SOUTH,
+	'3': commons.DS4_BUTTON_DPAD_SOUTHEAST,
+	'4': commons.DS4_BUTTON_DPAD_WEST,
+	'5': commons.DS4_BUTTON_DPAD_NONE,
+	'6': commons.DS4_BUTTON_DPAD_EAST,
+	'7': commons.DS4_BUTTON_DPAD_NORTHWEST,
+	'8': commons.DS4_BUTTON_DPAD_NORTH,
+	'9': commons.DS4_BUTTON_DPAD_NORTHEAST,
+}
+
+// mirrorDirection swaps west and east in a D-pad direction
+func mirrorDirection(direction commons.DS4DPadDirection) commons.DS4DPadDirection {
+	if direction == commons.DS4_BUTTON_DPAD_NONE {
+		return direction
+	}
+	return (8 - direction) % 8
+}
+
+// ParseMotion parses a motion written in numpad notation, such as "236P", "623K",
+// "41236HP", "[4]6P" (charge) or "2LP+LK". Directions are digits 1-9 (5 = neutral),
+// a direction in brackets is charged, and buttons are names made of letters, joined
+// with '+'. Several motions can be chained with spaces, commas or '>'.
+func ParseMotion(notation string, options MotionOptions) (Motion, error) {
+	if options.FrameRate <= 0 {
+		options.FrameRate = DefaultMotionFrameRate
+	}
+	if options.FramesPerDirection <= 0 {
+		options.FramesPerDirection = DefaultMotionFramesPerDirection
+	}
+	if options.ChargeFrames <= 0 {
+		options.ChargeFrames = DefaultMotionChargeFrames
+	}
+	if options.ButtonFrames <= 0 {
+		options.ButtonFrames = DefaultMotionButtonFrames
+	}
+
+	motion := Motion{FrameRate: options.FrameRate}
+	direction := commons.DS4_BUTTON_DPAD_NONE
+
+	direct := func(c byte) (commons.DS4DPadDirection, error) {
+		d, ok := numpadDirections[c]
+		if !ok {
+			return 0, fmt.Errorf("invalid direction %q in motion %q", c, notation)
+		}
+		if options.FacingLeft {
+			d = mirrorDirection(d)
+		}
+		return d, nil
+	}
+
+	for i := 0; i < len(notation); {
+		c := notation[i]
+		switch {
+		case c == ' ' || c == ',' || c == '>':
+			i++
+
+		case c >= '0' && c <= '9':
+			d, err := direct(c)
+			if err != nil {
+				return Motion{}, err
+			}
+			direction = d
+			motion.Steps = append(motion.Steps, MotionStep{Direction: d, Frames: options.FramesPerDirection})
+			i++
+
+		case c == '[':
+			if i+2 >= len(notation) || notation[i+2] != ']' {
+				return Motion{}, fmt.Errorf("invalid charge at position %d in motion %q, expected [<direction>]", i, notation)
+			}
+			d, err := direct(notation[i+1])
+			if err != nil {
+				return Motion{}, err
+			}
+			direction = d
+			motion.Steps = append(motion.Steps, MotionStep{Direction: d, Frames: options.ChargeFrames})
+			i += 3
+
+		case isMotionLetter(c):
+			var buttons []string
+			for {
+				start := i
+				for i < len(notation) && isMotionLetter(notation[i]) {
+					i++
+				}
+				if start == i {
+					return Motion{}, fmt.Errorf("missing button after '+' in motion %q", notation)
+				}
+				buttons = append(buttons, notation[start:i])
+				if i >= len(notation) || notation[i] != '+' {
+					break
+				}
+				i++
+			}
+			motion.Steps = append(motion.Steps, MotionStep{Direction: direction, Buttons: buttons, Frames: options.ButtonFrames})
+			direction = commons.DS4_BUTTON_DPAD_NONE
+
+		default:
+			return Motion{}, fmt.Errorf("unexpected character %q in motion %q", c, notation)
+		}
+	}
+
+	return motion, nil
+}
+
+// isMotionLetter reports whether c can be part of a button name
+func isMotionLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// perform runs a motion frame by frame, calling set for each step with the button names
+// resolved through buttons, after releasing everything in the motion with release.
+// The frame clock is absolute, so timing errors do not add up.
+func (g *BaseGamepad) perform(m Motion, buttons map[string]uint16, dpadMask uint16, update func() error, set func(direction commons.DS4DPadDirection, buttons uint16), release func(mask uint16)) (*TimedAction, error) {
+	mask := dpadMask
+	resolved := make([]uint16, len(m.Steps))
+	for i, step := range m.Steps {
+		for _, name := range step.Buttons {
+			b, ok := buttons[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown button %q in motion", name)
+			}
+			resolved[i] |= b
+		}
+		mask |= resolved[i]
+	}
+	if m.FrameRate <= 0 {
+		m.FrameRate = DefaultMotionFrameRate
+	}
+	frame := float64(time.Second) / m.FrameRate
+
+	return g.startAction(control{kind: controlButton, mask: mask}, update, func(a *TimedAction) {
+		begin := time.Now()
+		frames := 0
+		for i, step := range m.Steps {
+			if !a.sleepUntil(begin.Add(time.Duration(float64(frames) * frame))) {
+				return
+			}
+			if !a.apply(func() {
+				release(mask)
+				set(step.Direction, resolved[i])
+			}) {
+				return
+			}
+			frames += step.Frames
+		}
+		a.sleepUntil(begin.Add(time.Duration(float64(frames) * frame)))
+	}, func() { release(mask) }), nil
+}
+
+// PerformMotion performs a motion through the XUSB_GAMEPAD_DPAD_* buttons, pressing the
+// buttons named in the motion as mapped by buttons (e.g. {"P": commons.XUSB_GAMEPAD_X})
+func (g *VX360Gamepad) PerformMotion(m Motion, buttons map[string]commons.XUSBButton) (*TimedAction, error) {
+	mapping := make(map[string]uint16, len(buttons))
+	for name, b := range buttons {
+		mapping[name] = uint16(b)
+	}
+
+	return g.perform(m, mapping, uint16(commons.XUSB_GAMEPAD_DPAD), g.update,
+		func(direction commons.DS4DPadDirection, pressed uint16) {
+			g.report.WButtons |= uint16(commons.DS4DPadToXUSB(direction)) | pressed
+		},
+		func(mask uint16) { g.report.WButtons &^= mask })
+}
+
+// PerformMotion performs a motion through the directional pad (hat), pressing the
+// buttons named in the motion as mapped by buttons (e.g. {"P": commons.DS4_BUTTON_SQUARE})
+func (g *VDS4Gamepad) PerformMotion(m Motion, buttons map[string]commons.DS4Button) (*TimedAction, error) {
+	mapping := make(map[string]uint16, len(buttons))
+	for name, b := range buttons {
+		mapping[name] = uint16(b)
+	}
+
+	return g.perform(m, mapping, 0xF, g.update,
+		func(direction commons.DS4DPadDirection, pressed uint16) {
+			g.dpad = uint16(commons.DS4DPadToXUSB(direction))
+			g.report.WButtons |= pressed
+		},
+		func(mask uint16) {
+			g.report.WButtons &^= mask &^ 0xF
+			g.dpad = 0
+		})
+}
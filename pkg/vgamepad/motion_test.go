@@ -0,0 +1,181 @@
+package vgamepad
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+func TestParseMotion(t *testing.T) {
+	const (
+		none  = commons.DS4_BUTTON_DPAD_NONE
+		south = commons.DS4_BUTTON_DPAD_SOUTH
+		east  = commons.DS4_BUTTON_DPAD_EAST
+		west  = commons.DS4_BUTTON_DPAD_WEST
+	)
+
+	// A quarter circle: each digit is its own step, and the button is pressed on the last direction
+	m, err := ParseMotion("236P", MotionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MotionStep{
+		{Direction: south, Frames: DefaultMotionFramesPerDirection},
+		{Direction: commons.DS4_BUTTON_DPAD_SOUTHEAST, Frames: DefaultMotionFramesPerDirection},
+		{Direction: east, Frames: DefaultMotionFramesPerDirection},
+		{Direction: east, Buttons: []string{"P"}, Frames: DefaultMotionButtonFrames},
+	}
+	if !reflect.DeepEqual(m.Steps, want) || m.FrameRate != DefaultMotionFrameRate {
+		t.Errorf("ParseMotion(236P) = %+v, want %+v at %v fps", m, want, DefaultMotionFrameRate)
+	}
+
+	// A charge is held longer, and a button resets the direction to neutral for what follows
+	m, err = ParseMotion("[4]6P K", MotionOptions{ChargeFrames: 30, ButtonFrames: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []MotionStep{
+		{Direction: west, Frames: 30},
+		{Direction: east, Frames: DefaultMotionFramesPerDirection},
+		{Direction: east, Buttons: []string{"P"}, Frames: 5},
+		{Direction: none, Buttons: []string{"K"}, Frames: 5},
+	}
+	if !reflect.DeepEqual(m.Steps, want) {
+		t.Errorf("ParseMotion([4]6P K) steps = %+v, want %+v", m.Steps, want)
+	}
+
+	// Several buttons pressed together
+	m, err = ParseMotion("2LP+LK", MotionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := m.Steps[len(m.Steps)-1]; !reflect.DeepEqual(last.Buttons, []string{"LP", "LK"}) || last.Direction != south {
+		t.Errorf("last step of 2LP+LK = %+v, want LP and LK pressed down", last)
+	}
+
+	if m, err := ParseMotion("", MotionOptions{}); err != nil || len(m.Steps) != 0 {
+		t.Errorf("ParseMotion(\"\") = %+v, %v, want no steps", m, err)
+	}
+}
+
+func TestParseMotionSeparators(t *testing.T) {
+	reference, err := ParseMotion("2P5K", MotionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, notation := range []string{"2P 5K", "2P,5K", "2P > 5K", " 2P>5K "} {
+		m, err := ParseMotion(notation, MotionOptions{})
+		if err != nil || !reflect.DeepEqual(m, reference) {
+			t.Errorf("ParseMotion(%q) = %+v, %v, want the same as 2P5K", notation, m, err)
+		}
+	}
+}
+
+func TestMotionFacingLeft(t *testing.T) {
+	// Only the horizontal part of each direction is mirrored
+	mirrored := map[byte]byte{'1': '3', '2': '2', '3': '1', '4': '6', '5': '5', '6': '4', '7': '9', '8': '8', '9': '7'}
+	for digit, want := range mirrored {
+		left, err := ParseMotion(string(digit), MotionOptions{FacingLeft: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		right, _ := ParseMotion(string(want), MotionOptions{})
+		if left.Steps[0].Direction != right.Steps[0].Direction {
+			t.Errorf("%c facing left = %v, want %v (%c)", digit, left.Steps[0].Direction, right.Steps[0].Direction, want)
+		}
+	}
+
+	for d := commons.DS4DPadDirection(0); d <= commons.DS4_BUTTON_DPAD_NONE; d++ {
+		if back := mirrorDirection(mirrorDirection(d)); back != d {
+			t.Errorf("mirroring %v twice = %v", d, back)
+		}
+	}
+}
+
+func TestParseMotionErrors(t *testing.T) {
+	tests := []struct {
+		notation string
+		reason   string // Part of the expected error
+	}{
+		{"0P", "invalid direction '0'"},
+		{"[0]6P", "invalid direction '0'"},
+		{"[4", "invalid charge at position 0"},
+		{"6[46]P", "invalid charge at position 1"},
+		{"2P+", "missing button"},
+		{"2P+6K", "missing button"},
+		{"2#P", "unexpected character '#'"},
+	}
+	for _, tt := range tests {
+		_, err := ParseMotion(tt.notation, MotionOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("ParseMotion(%q) = %v, want an error about %q", tt.notation, err, tt.reason)
+		}
+	}
+}
+
+func TestMotionDuration(t *testing.T) {
+	m, err := ParseMotion("236P", MotionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 directions of 2 frames and 3 frames of button, at 60 fps
+	if d := m.Duration(); d != 150*time.Millisecond {
+		t.Errorf("Duration() = %v, want 150ms", d)
+	}
+
+	m.FrameRate = 30
+	if d := m.Duration(); d != 300*time.Millisecond {
+		t.Errorf("Duration() at 30 fps = %v, want 300ms", d)
+	}
+}
+
+func TestPerformMotion(t *testing.T) {
+	g := &BaseGamepad{}
+	m, err := ParseMotion("26P", MotionOptions{FrameRate: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.perform(m, map[string]uint16{"K": 0x100}, 0xF, nil, nil, nil); err == nil || !strings.Contains(err.Error(), `"P"`) {
+		t.Errorf("perform with an unknown button = %v, want an error naming it", err)
+	}
+
+	type state struct {
+		direction commons.DS4DPadDirection
+		buttons   uint16
+	}
+	var (
+		current  state
+		sent     []state
+		released []uint16
+	)
+	a, err := g.perform(m, map[string]uint16{"P": 0x100}, 0xF,
+		func() error { sent = append(sent, current); return nil },
+		func(direction commons.DS4DPadDirection, buttons uint16) { current = state{direction, buttons} },
+		func(mask uint16) { released = append(released, mask); current = state{commons.DS4_BUTTON_DPAD_NONE, 0} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []state{
+		{commons.DS4_BUTTON_DPAD_SOUTH, 0},
+		{commons.DS4_BUTTON_DPAD_EAST, 0},
+		{commons.DS4_BUTTON_DPAD_EAST, 0x100},
+		{commons.DS4_BUTTON_DPAD_NONE, 0}, // Released once the motion is over
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("reports = %v, want %v", sent, want)
+	}
+	// Everything the motion touches is released before each step and at the end
+	for _, mask := range released {
+		if mask != 0x10F {
+			t.Errorf("released mask %#x, want %#x", mask, 0x10F)
+		}
+	}
+}
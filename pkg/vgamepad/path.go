@@ -0,0 +1,121 @@
+package vgamepad
+
+import (
+	"math"
+	"time"
+)
+
+// Point is a joystick position, each coordinate between -1.0 and 1.0.
+// Paths use the usual math convention: X points right and Y points up.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Path is a curve that a joystick can trace
+type Path interface {
+	// At returns the position of the path at progress t (0.0 = start, 1.0 = end)
+	At(t float64) Point
+}
+
+// PathFunc adapts an ordinary function to the Path interface
+type PathFunc func(t float64) Point
+
+// At calls f(t)
+func (f PathFunc) At(t float64) Point {
+	return f(t)
+}
+
+// Line returns a straight path from one position to another
+func Line(from, to Point) Path {
+	return PathFunc(func(t float64) Point {
+		return Point{X: from.X + (to.X-from.X)*t, Y: from.Y + (to.Y-from.Y)*t}
+	})
+}
+
+// Arc returns a circular arc around the center, from one angle to another (in degrees,
+// 0 = right, 90 = up). The arc runs counterclockwise if toAngle > fromAngle, clockwise otherwise.
+func Arc(radius, fromAngle, toAngle float64) Path {
+	return PathFunc(func(t float64) Point {
+		angle := (fromAngle + (toAngle-fromAngle)*t) * math.Pi / 180
+		return Point{X: radius * math.Cos(angle), Y: radius * math.Sin(angle)}
+	})
+}
+
+// Circle returns a full counterclockwise rotation around the center, starting on the right.
+// Use a negative number of turns to rotate clockwise.
+func Circle(radius, turns float64) Path {
+	return Arc(radius, 0, 360*turns)
+}
+
+// FigureEight returns a horizontal figure-eight through the center, with lobes reaching radius on each side
+func FigureEight(radius float64) Path {
+	return PathFunc(func(t float64) Point {
+		angle := 2 * math.Pi * t
+		return Point{X: radius * math.Sin(angle), Y: radius * math.Sin(2*angle) / 2}
+	})
+}
+
+// Bezier returns the Bézier curve defined by the control points (2 points give a line,
+// 3 a quadratic curve, 4 a cubic curve, etc.). It starts on the first point and ends on the last one.
+func Bezier(points ...Point) Path {
+	points = append([]Point(nil), points...)
+	return PathFunc(func(t float64) Point {
+		if len(points) == 0 {
+			return Point{}
+		}
+		// De Casteljau's algorithm
+		work := append([]Point(nil), points...)
+		for n := len(work) - 1; n > 0; n-- {
+			for i := 0; i < n; i++ {
+				work[i] = Point{
+					X: work[i].X + (work[i+1].X-work[i].X)*t,
+					Y: work[i].Y + (work[i+1].Y-work[i].Y)*t,
+				}
+			}
+		}
+		return work[0]
+	})
+}
+
+// TraceLeftJoystick moves the left joystick along path over d, sending reports at the update rate.
+// The joystick stays on the last point of the path. The points go through the same curves and
+// processing as LeftJoystickFloat.
+func (g *VX360Gamepad) TraceLeftJoystick(path Path, d time.Duration) *TimedAction {
+	return g.animate(control{kind: controlLeftJoystick}, g.update, d, func(t float64) {
+		p := path.At(t)
+		g.leftJoystickFloat(p.X, p.Y)
+	})
+}
+
+// TraceRightJoystick moves the right joystick along path over d, sending reports at the update rate.
+// The joystick stays on the last point of the path. The points go through the same curves and
+// processing as RightJoystickFloat.
+func (g *VX360Gamepad) TraceRightJoystick(path Path, d time.Duration) *TimedAction {
+	return g.animate(control{kind: controlRightJoystick}, g.update, d, func(t float64) {
+		p := path.At(t)
+		g.rightJoystickFloat(p.X, p.Y)
+	})
+}
+
+// TraceLeftJoystick moves the left joystick along path over d, sending reports at the update rate.
+// The joystick stays on the last point of the path. The points go through the same curves and
+// processing as LeftJoystickFloat. The Y axis of the path
+// follows the axis convention of the gamepad, like LeftJoystickFloat.
+func (g *VDS4Gamepad) TraceLeftJoystick(path Path, d time.Duration) *TimedAction {
+	return g.animate(control{kind: controlLeftJoystick}, g.update, d, func(t float64) {
+		p := path.At(t)
+		g.leftJoystickFloat(p.X, p.Y)
+	})
+}
+
+// TraceRightJoystick moves the right joystick along path over d, sending reports at the update rate.
+// The joystick stays on the last point of the path. The points go through the same curves and
+// processing as RightJoystickFloat. The Y axis of the path
+// follows the axis convention of the gamepad, like RightJoystickFloat.
+func (g *VDS4Gamepad) TraceRightJoystick(path Path, d time.Duration) *TimedAction {
+	return g.animate(control{kind: controlRightJoystick}, g.update, d, func(t float64) {
+		p := path.At(t)
+		g.rightJoystickFloat(p.X, p.Y)
+	})
+}
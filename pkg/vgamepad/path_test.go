@@ -0,0 +1,115 @@
+package vgamepad
+
+import (
+	"math"
+	"testing"
+)
+
+// samePoint reports whether two points are equal within rounding errors
+func samePoint(p, q Point) bool {
+	return math.Abs(p.X-q.X) < 1e-9 && math.Abs(p.Y-q.Y) < 1e-9
+}
+
+func TestCircleAndArc(t *testing.T) {
+	ccw, cw := Circle(0.8, 1), Circle(0.8, -1)
+	for i := 0; i <= 100; i++ {
+		p := ccw.At(float64(i) / 100)
+		if r := math.Hypot(p.X, p.Y); math.Abs(r-0.8) > 1e-9 {
+			t.Fatalf("Circle(0.8) at %v is at radius %v", float64(i)/100, r)
+		}
+	}
+
+	// Counterclockwise goes up first, clockwise goes down, and both come back to the right
+	checks := []struct {
+		name string
+		got  Point
+		want Point
+	}{
+		{"counterclockwise quarter", ccw.At(0.25), Point{0, 0.8}},
+		{"clockwise quarter", cw.At(0.25), Point{0, -0.8}},
+		{"counterclockwise end", ccw.At(1), Point{0.8, 0}},
+		{"clockwise end", cw.At(1), Point{0.8, 0}},
+		{"arc start", Arc(1, 90, 180).At(0), Point{0, 1}},
+		{"arc end", Arc(1, 90, 180).At(1), Point{-1, 0}},
+		{"arc backwards", Arc(1, 90, 0).At(0.5), Point{math.Sqrt(0.5), math.Sqrt(0.5)}},
+	}
+	for _, c := range checks {
+		if !samePoint(c.got, c.want) {
+			t.Errorf("%s = %+v, want %+v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestFigureEight(t *testing.T) {
+	path := FigureEight(1)
+	for _, tt := range []float64{0, 0.5, 1} {
+		if p := path.At(tt); !samePoint(p, Point{}) {
+			t.Errorf("At(%v) = %+v, want the center", tt, p)
+		}
+	}
+	// The second lobe is the first one mirrored left to right
+	for i := 0; i < 50; i++ {
+		tt := float64(i) / 100
+		p, q := path.At(tt), path.At(tt+0.5)
+		if !samePoint(p, Point{-q.X, q.Y}) {
+			t.Errorf("At(%v) = %+v and At(%v) = %+v are not mirrored", tt, p, tt+0.5, q)
+		}
+	}
+	if p := path.At(0.25); !samePoint(p, Point{1, 0}) {
+		t.Errorf("At(0.25) = %+v, want the tip of the right lobe", p)
+	}
+}
+
+func TestBezier(t *testing.T) {
+	a, b := Point{-1, 0.5}, Point{0.5, -1}
+	line, bezier := Line(a, b), Bezier(a, b)
+	for i := 0; i <= 10; i++ {
+		tt := float64(i) / 10
+		if p, q := bezier.At(tt), line.At(tt); !samePoint(p, q) {
+			t.Errorf("Bezier of 2 points at %v = %+v, want the line %+v", tt, p, q)
+		}
+	}
+
+	points := []Point{{-1, 0}, {-1, 1}, {1, 1}, {1, 0}}
+	cubic := Bezier(points...)
+	points[0] = Point{0, 0} // Bezier keeps its own copy
+	if p := cubic.At(0); !samePoint(p, Point{-1, 0}) {
+		t.Errorf("At(0) = %+v, want the first point", p)
+	}
+	if p := cubic.At(1); !samePoint(p, Point{1, 0}) {
+		t.Errorf("At(1) = %+v, want the last point", p)
+	}
+	// Symmetric control points: the middle is on the axis of symmetry, 3/4 of the way up
+	if p := cubic.At(0.5); !samePoint(p, Point{0, 0.75}) {
+		t.Errorf("At(0.5) = %+v, want {0 0.75}", p)
+	}
+
+	if p := Bezier().At(0.5); p != (Point{}) {
+		t.Errorf("Bezier without points = %+v, want the center", p)
+	}
+}
+
+func TestDS4TraceYAxis(t *testing.T) {
+	up := Arc(1, 0, 90).At(1)
+
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.leftJoystickFloat(up.X, up.Y)
+	if g.report.BThumbLX != 128 || g.report.BThumbLY != 1 {
+		t.Errorf("up with the normalized convention = %d, %d, want 128, 1 (top)", g.report.BThumbLX, g.report.BThumbLY)
+	}
+
+	g.SetAxisConvention(AxisRaw)
+	g.rightJoystickFloat(up.X, up.Y)
+	if g.report.BThumbRY != 255 {
+		t.Errorf("Y = 1 with the raw convention = %d, want 255", g.report.BThumbRY)
+	}
+
+	// Points go through the processing of the joystick, here snapping to 4 directions
+	g.SetAxisConvention(AxisNormalized)
+	g.SetLeftJoystickProcessing(StickProcessing{Snap: Snap4Way})
+	p := Arc(1, 0, 90).At(0.7)
+	g.leftJoystickFloat(p.X, p.Y)
+	if g.report.BThumbLX != 128 || g.report.BThumbLY != 1 {
+		t.Errorf("point at 63° snapped to %d, %d, want up (128, 1)", g.report.BThumbLX, g.report.BThumbLY)
+	}
+}
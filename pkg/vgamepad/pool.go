@@ -0,0 +1,338 @@
+package vgamepad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// PoolOptions configures a Pool
+type PoolOptions struct {
+	Size  int           // Maximum number of gamepads on the bus, idle or in use
+	Lease time.Duration // How long a gamepad can be held before it is reclaimed, 0 means forever
+}
+
+// PoolStats describes the state and health of a Pool
+type PoolStats struct {
+	Size      int    // Maximum number of gamepads
+	InUse     int    // Gamepads acquired and not released
+	Idle      int    // Gamepads released and kept plugged for the next Acquire
+	Waiting   int    // Acquire calls waiting for a free slot
+	Created   uint64 // Gamepads created
+	Reused    uint64 // Acquire calls served by an idle gamepad
+	Reclaimed uint64 // Gamepads closed because their lease expired
+	Failed    uint64 // Gamepads that could not be created, or were closed because they failed to reset
+	LastError error  // Last error creating or resetting a gamepad
+}
+
+// Delays between two attempts of Acquire to create a gamepad on a bus full of targets outside of the pool
+const (
+	poolRetryMin = 50 * time.Millisecond
+	poolRetryMax = 2 * time.Second
+)
+
+// restorable is a gamepad that can be restored to the state it was created in
+type restorable interface {
+	restoreDefaults()
+}
+
+// poolEntry is a gamepad of a pool
+type poolEntry struct {
+	padType PadType
+	gamepad Controller
+	timer   *time.Timer // Reclaims the gamepad when its lease expires, nil if idle or without lease
+}
+
+// Pool hands out gamepads, keeping at most a given number of them on the bus.
+// Released gamepads are reset to neutral and kept plugged for the next Acquire of the same type.
+type Pool struct {
+	options PoolOptions
+	create  func(padType PadType) (Controller, error)
+
+	mu      sync.Mutex
+	idle    []*poolEntry
+	inUse   map[Controller]*poolEntry
+	total   int           // Gamepads idle, in use or being created
+	changed chan struct{} // Closed when a slot or an idle gamepad may have become available
+	stats   PoolStats
+	closed  bool
+}
+
+// NewPool creates a Pool of gamepads on the bus
+func NewPool(options PoolOptions) (*Pool, error) {
+	if options.Size <= 0 {
+		return nil, fmt.Errorf("invalid pool size %d", options.Size)
+	}
+	if _, err := GetVBus(); err != nil {
+		return nil, err
+	}
+	return newPool(options, func(padType PadType) (Controller, error) {
+		gamepad, err := newGamepad(padType, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return gamepad, nil
+	}), nil
+}
+
+// newPool creates a Pool creating its gamepads with create
+func newPool(options PoolOptions, create func(padType PadType) (Controller, error)) *Pool {
+	return &Pool{
+		options: options,
+		create:  create,
+		inUse:   make(map[Controller]*poolEntry),
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire returns a gamepad of the given type, waiting until a slot is free or ctx is done.
+// If the bus is full because of targets outside of the pool, Acquire also tries again
+// from time to time, backing off up to every 2 seconds.
+// The gamepad must be given back with Release before its lease expires.
+func (p *Pool) Acquire(ctx context.Context, padType PadType) (Controller, error) {
+	if padType != PadX360 && padType != PadDS4 {
+		return nil, fmt.Errorf("unknown pad type %q", padType)
+	}
+
+	var retry time.Duration // Delay before trying again on a full bus, 0 until the bus is found full
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("the pool is closed")
+		}
+
+		if entry := p.takeIdle(padType); entry != nil {
+			p.stats.Reused++
+			p.lease(entry)
+			p.mu.Unlock()
+			return entry.gamepad, nil
+		}
+
+		var evicted *poolEntry
+		if p.total >= p.options.Size && len(p.idle) > 0 {
+			// Make room by unplugging an idle gamepad of another type, whose slot is taken over
+			evicted = p.idle[0]
+			p.idle = p.idle[1:]
+			p.total--
+		}
+
+		fullBus := false
+		if p.total < p.options.Size {
+			p.total++
+			p.mu.Unlock()
+			if evicted != nil {
+				evicted.gamepad.Close()
+			}
+			gamepad, err := p.create(padType)
+			p.mu.Lock()
+
+			if err == nil {
+				p.stats.Created++
+				entry := &poolEntry{padType: padType, gamepad: gamepad}
+				if p.closed {
+					p.mu.Unlock()
+					gamepad.Close()
+					p.freeSlot()
+					p.mu.Lock()
+					continue
+				}
+				p.lease(entry)
+				p.mu.Unlock()
+				return gamepad, nil
+			}
+
+			p.total--
+			p.stats.Failed++
+			p.stats.LastError = err
+			var vigemErr commons.ViGEmError
+			if !errors.As(err, &vigemErr) || vigemErr != commons.VIGEM_ERROR_NO_FREE_SLOT {
+				p.mu.Unlock()
+				return nil, err
+			}
+			// The bus is full because of targets outside of the pool: wait for a release, or try again later
+			fullBus = true
+		}
+
+		var retryTimer *time.Timer
+		var retryC <-chan time.Time // nil when there is nothing to retry
+		if fullBus {
+			if retry = 2 * retry; retry < poolRetryMin {
+				retry = poolRetryMin
+			} else if retry > poolRetryMax {
+				retry = poolRetryMax
+			}
+			retryTimer = time.NewTimer(retry)
+			retryC = retryTimer.C
+		}
+
+		changed := p.changed
+		p.stats.Waiting++
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-retryC:
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+		p.mu.Lock()
+		p.stats.Waiting--
+		if err := ctx.Err(); err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+	}
+}
+
+// Release resets a gamepad acquired from the pool to neutral, restores all its settings (turbo,
+// processing, watchdog, notification...) to their defaults and gives it back to the pool
+func (p *Pool) Release(gamepad Controller) error {
+	p.mu.Lock()
+	entry, ok := p.inUse[gamepad]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("the gamepad is not in use in this pool")
+	}
+	// The gamepad keeps its slot, but is neither in use nor idle while it is reset
+	delete(p.inUse, gamepad)
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	p.mu.Unlock()
+
+	if r, ok := gamepad.(restorable); ok {
+		r.restoreDefaults()
+	} else {
+		gamepad.Reset()
+	}
+	err := gamepad.Update()
+
+	p.mu.Lock()
+	if err == nil && !p.closed {
+		p.idle = append(p.idle, entry)
+		p.notify()
+		p.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		p.stats.Failed++
+		p.stats.LastError = err
+	}
+	p.mu.Unlock()
+
+	gamepad.Close()
+	p.freeSlot()
+	return err
+}
+
+// Renew restarts the lease of a gamepad acquired from the pool
+func (p *Pool) Renew(gamepad Controller) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.inUse[gamepad]
+	if !ok {
+		return fmt.Errorf("the gamepad is not in use in this pool")
+	}
+	p.lease(entry)
+	return nil
+}
+
+// Stats returns the state and health of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Size = p.options.Size
+	stats.InUse = len(p.inUse)
+	stats.Idle = len(p.idle)
+	return stats
+}
+
+// Close closes every gamepad of the pool, including the ones in use, and fails pending Acquire calls
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for gamepad, entry := range p.inUse {
+		if entry.timer != nil {
+			entry.timer.Stop()
+		}
+		gamepad.Close()
+		delete(p.inUse, gamepad)
+		p.total--
+	}
+	for _, entry := range p.idle {
+		entry.gamepad.Close()
+		p.total--
+	}
+	p.idle = nil
+	p.notify()
+}
+
+// takeIdle removes an idle gamepad of the given type from the pool, or returns nil (p.mu must be held)
+func (p *Pool) takeIdle(padType PadType) *poolEntry {
+	for i, entry := range p.idle {
+		if entry.padType == padType {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return entry
+		}
+	}
+	return nil
+}
+
+// lease marks a gamepad as in use, and starts its lease again (p.mu must be held)
+func (p *Pool) lease(entry *poolEntry) {
+	p.inUse[entry.gamepad] = entry
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	if p.options.Lease <= 0 {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(p.options.Lease, func() {
+		p.mu.Lock()
+		if p.inUse[entry.gamepad] != entry || entry.timer != timer {
+			p.mu.Unlock()
+			return
+		}
+		// The holder may still use its reference: unplug the gamepad rather than handing it out again
+		delete(p.inUse, entry.gamepad)
+		entry.timer = nil
+		p.stats.Reclaimed++
+		p.mu.Unlock()
+
+		entry.gamepad.Close()
+		p.freeSlot()
+	})
+	entry.timer = timer
+}
+
+// freeSlot gives the slot of a gamepad that was closed back to the pool
+func (p *Pool) freeSlot() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total--
+	p.notify()
+}
+
+// notify wakes the Acquire calls waiting for a slot up (p.mu must be held)
+func (p *Pool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
@@ -0,0 +1,289 @@
+package vgamepad
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// poolPad is a gamepad handed out by a test pool
+type poolPad struct {
+	Controller
+	padType   PadType
+	resets    atomic.Int32
+	closed    atomic.Int32
+	updateErr error  // Returned by Update
+	onReset   func() // Called by Reset, if not nil
+}
+
+func (f *poolPad) Reset() {
+	f.resets.Add(1)
+	if f.onReset != nil {
+		f.onReset()
+	}
+}
+
+func (f *poolPad) Update() error {
+	return f.updateErr
+}
+
+func (f *poolPad) Close() {
+	f.closed.Add(1)
+}
+
+// testPool returns a pool whose gamepads are poolPads, failing to create them while fail returns an error
+func testPool(options PoolOptions, fail func() error) (*Pool, *[]*poolPad) {
+	var mu sync.Mutex
+	var created []*poolPad
+	p := newPool(options, func(padType PadType) (Controller, error) {
+		if fail != nil {
+			if err := fail(); err != nil {
+				return nil, err
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		pad := &poolPad{padType: padType}
+		created = append(created, pad)
+		return pad, nil
+	})
+	return p, &created
+}
+
+func TestPoolReuse(t *testing.T) {
+	p, created := testPool(PoolOptions{Size: 2}, nil)
+	defer p.Close()
+	ctx := context.Background()
+
+	a, _ := p.Acquire(ctx, PadX360)
+	if err := p.Release(a); err != nil {
+		t.Fatal(err)
+	}
+	if a.(*poolPad).resets.Load() != 1 || a.(*poolPad).closed.Load() != 0 {
+		t.Error("a released gamepad was not reset, or was unplugged")
+	}
+
+	// The idle gamepad serves the next Acquire of its type only
+	b, _ := p.Acquire(ctx, PadDS4)
+	again, _ := p.Acquire(ctx, PadX360)
+	if again != a || b == a || len(*created) != 2 {
+		t.Errorf("Acquire created %d gamepads, want the idle X360 handed out again", len(*created))
+	}
+	if s := p.Stats(); s.Created != 2 || s.Reused != 1 || s.InUse != 2 || s.Idle != 0 {
+		t.Errorf("Stats() = %+v", s)
+	}
+	p.Release(a)
+	if err := p.Release(a); err == nil {
+		t.Error("Release of a gamepad not in use succeeded")
+	}
+	if _, err := p.Acquire(ctx, "ps5"); err == nil {
+		t.Error("Acquire of an unknown type succeeded")
+	}
+}
+
+func TestPoolEvictsIdleOfAnotherType(t *testing.T) {
+	p, created := testPool(PoolOptions{Size: 1}, nil)
+	defer p.Close()
+
+	a, _ := p.Acquire(context.Background(), PadX360)
+	p.Release(a)
+	b, err := p.Acquire(context.Background(), PadDS4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.(*poolPad).closed.Load() != 1 || b.(*poolPad).padType != PadDS4 || len(*created) != 2 {
+		t.Error("the idle X360 was not unplugged to make room for the DS4")
+	}
+	if s := p.Stats(); s.InUse != 1 || s.Idle != 0 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestPoolWaitsForARelease(t *testing.T) {
+	p, _ := testPool(PoolOptions{Size: 1}, nil)
+	defer p.Close()
+
+	a, _ := p.Acquire(context.Background(), PadX360)
+
+	// A full pool makes Acquire wait until ctx is done...
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx, PadX360); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() on a full pool = %v, want the deadline", err)
+	}
+
+	// ...or until a gamepad is released
+	got := make(chan Controller)
+	go func() {
+		b, _ := p.Acquire(context.Background(), PadX360)
+		got <- b
+	}()
+	waitFor(t, "Acquire to wait", func() bool { return p.Stats().Waiting == 1 })
+	p.Release(a)
+	select {
+	case b := <-got:
+		if b != a {
+			t.Error("the waiting Acquire did not get the released gamepad")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Release did not wake the waiting Acquire up")
+	}
+	if s := p.Stats(); s.Waiting != 0 {
+		t.Errorf("Waiting = %d after the wait", s.Waiting)
+	}
+}
+
+func TestPoolRetriesAFullBus(t *testing.T) {
+	// The bus is full because of other targets, which go away after a while
+	var attempts atomic.Int32
+	p, _ := testPool(PoolOptions{Size: 4}, func() error {
+		if attempts.Add(1) <= 3 {
+			return commons.VIGEM_ERROR_NO_FREE_SLOT
+		}
+		return nil
+	})
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Acquire(ctx, PadDS4); err != nil {
+		t.Fatalf("Acquire() = %v, want a retry to succeed without any release", err)
+	}
+	// Backing off from the minimum delay: 50ms, 100ms then 200ms
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("succeeded after %v, too early for the backoff", elapsed)
+	}
+	if s := p.Stats(); s.Failed != 3 || !errors.Is(s.LastError, commons.VIGEM_ERROR_NO_FREE_SLOT) || s.Waiting != 0 {
+		t.Errorf("Stats() = %+v", s)
+	}
+
+	// Other errors are returned right away
+	broken := errors.New("driver gone")
+	p2, _ := testPool(PoolOptions{Size: 1}, func() error { return broken })
+	if _, err := p2.Acquire(context.Background(), PadX360); err != broken {
+		t.Errorf("Acquire() = %v, want the creation error", err)
+	}
+	if s := p2.Stats(); s.Failed != 1 || s.InUse != 0 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestPoolReleaseOutsideOfTheLock(t *testing.T) {
+	p, created := testPool(PoolOptions{Size: 1}, nil)
+	defer p.Close()
+
+	a, _ := p.Acquire(context.Background(), PadX360)
+	pad := a.(*poolPad)
+	// The pool stays usable while the gamepad is reset, which is neither in use nor idle by then
+	var during PoolStats
+	pad.onReset = func() { during = p.Stats() }
+	p.Release(a)
+	if during.InUse != 0 || during.Idle != 0 {
+		t.Errorf("Stats() during the reset = %+v", during)
+	}
+
+	// A gamepad failing to reset is unplugged and its slot freed
+	a, _ = p.Acquire(context.Background(), PadX360)
+	pad.onReset = nil
+	pad.updateErr = errors.New("unplugged")
+	if err := p.Release(a); err != pad.updateErr {
+		t.Errorf("Release() = %v, want the update error", err)
+	}
+	if pad.closed.Load() != 1 {
+		t.Error("the failing gamepad was not closed")
+	}
+	if s := p.Stats(); s.Failed != 1 || s.LastError != pad.updateErr || s.Idle != 0 {
+		t.Errorf("Stats() = %+v", s)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.Acquire(ctx, PadX360); err != nil || len(*created) != 2 {
+		t.Errorf("Acquire() = %v, want a new gamepad in the freed slot", err)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p, _ := testPool(PoolOptions{Size: 2}, nil)
+	a, _ := p.Acquire(context.Background(), PadX360)
+	b, _ := p.Acquire(context.Background(), PadX360)
+	p.Release(b)
+	p.Acquire(context.Background(), PadX360)
+
+	waiting := make(chan error)
+	go func() {
+		_, err := p.Acquire(context.Background(), PadDS4)
+		waiting <- err
+	}()
+	waitFor(t, "Acquire to wait", func() bool { return p.Stats().Waiting == 1 })
+	p.Close()
+	if err := <-waiting; err == nil {
+		t.Error("a waiting Acquire succeeded after Close")
+	}
+
+	// Close unplugs the gamepads in use; releasing them afterward is harmless
+	if a.(*poolPad).closed.Load() != 1 || b.(*poolPad).closed.Load() != 1 {
+		t.Error("Close left gamepads plugged")
+	}
+	if err := p.Release(a); err == nil {
+		t.Error("Release after Close succeeded")
+	}
+	if _, err := p.Acquire(context.Background(), PadX360); err == nil {
+		t.Error("Acquire after Close succeeded")
+	}
+
+	// And the idle ones
+	p, _ = testPool(PoolOptions{Size: 1}, nil)
+	a, _ = p.Acquire(context.Background(), PadDS4)
+	p.Release(a)
+	p.Close()
+	p.Close()
+	if a.(*poolPad).closed.Load() != 1 {
+		t.Error("Close left an idle gamepad plugged, or closed it twice")
+	}
+}
+
+func TestPoolLease(t *testing.T) {
+	p, _ := testPool(PoolOptions{Size: 1, Lease: 200 * time.Millisecond}, nil)
+	defer p.Close()
+
+	a, _ := p.Acquire(context.Background(), PadX360)
+	// Renewing restarts the lease
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if err := p.Renew(a); err != nil {
+			t.Fatalf("Renew() = %v before the lease expired", err)
+		}
+	}
+	if s := p.Stats(); s.Reclaimed != 0 {
+		t.Fatal("a renewed gamepad was reclaimed")
+	}
+
+	// An expired gamepad is unplugged, since its holder may still use it, and its slot freed
+	waitFor(t, "the lease to expire", func() bool { return p.Stats().Reclaimed == 1 })
+	if a.(*poolPad).closed.Load() != 1 {
+		t.Error("the reclaimed gamepad is still plugged")
+	}
+	if err := p.Renew(a); err == nil {
+		t.Error("Renew of a reclaimed gamepad succeeded")
+	}
+	if err := p.Release(a); err == nil {
+		t.Error("Release of a reclaimed gamepad succeeded")
+	}
+	b, _ := p.Acquire(context.Background(), PadX360)
+	if b == a {
+		t.Error("the reclaimed gamepad was handed out again")
+	}
+
+	// A released gamepad has no lease any more
+	p.Release(b)
+	time.Sleep(300 * time.Millisecond)
+	if s := p.Stats(); s.Reclaimed != 1 || s.Idle != 1 {
+		t.Errorf("Stats() = %+v, want the idle gamepad kept", s)
+	}
+}
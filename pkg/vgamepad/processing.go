@@ -0,0 +1,290 @@
+package vgamepad
+
+import (
+	"fmt"
+	"math"
+)
+
+// DeadzoneShape selects how the deadzone of a joystick is measured
+type DeadzoneShape int
+
+const (
+	DeadzoneRadial DeadzoneShape = iota // On the distance from the center
+	DeadzoneAxial                       // On each axis separately
+)
+
+// deadzoneShapeNames are the names of the deadzone shapes in text and JSON
+var deadzoneShapeNames = [...]string{
+	DeadzoneRadial: "radial",
+	DeadzoneAxial:  "axial",
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s DeadzoneShape) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(deadzoneShapeNames) {
+		return nil, fmt.Errorf("invalid deadzone shape %d", int(s))
+	}
+	return []byte(deadzoneShapeNames[s]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *DeadzoneShape) UnmarshalText(text []byte) error {
+	for i, name := range deadzoneShapeNames {
+		if name == string(text) {
+			*s = DeadzoneShape(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown deadzone shape %q", text)
+}
+
+// SnapMode selects the directions a joystick is snapped to
+type SnapMode int
+
+const (
+	SnapNone SnapMode = iota // No snapping
+	Snap4Way                 // Up, down, left and right
+	Snap8Way                 // Up, down, left, right and the diagonals
+)
+
+// snapModeNames are the names of the snap modes in text and JSON
+var snapModeNames = [...]string{
+	SnapNone: "none",
+	Snap4Way: "4-way",
+	Snap8Way: "8-way",
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m SnapMode) MarshalText() ([]byte, error) {
+	if m < 0 || int(m) >= len(snapModeNames) {
+		return nil, fmt.Errorf("invalid snap mode %d", int(m))
+	}
+	return []byte(snapModeNames[m]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *SnapMode) UnmarshalText(text []byte) error {
+	for i, name := range snapModeNames {
+		if name == string(text) {
+			*m = SnapMode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown snap mode %q", text)
+}
+
+// StickProcessing configures how float joystick values are processed before being
+// written to the report. The zero value leaves them untouched.
+type StickProcessing struct {
+	Deadzone        float64       `json:"deadzone,omitempty"`         // Input magnitude (0.0-1.0) under which the joystick stays neutral
+	Shape           DeadzoneShape `json:"shape,omitempty"`            // How the deadzone is measured
+	AntiDeadzone    float64       `json:"anti_deadzone,omitempty"`    // Output magnitude (0.0-1.0) of the smallest input past the deadzone, e.g. the deadzone of the game
+	OuterSaturation float64       `json:"outer_saturation,omitempty"` // Input magnitude (0.0-1.0) from which the output is full, 0 means 1.0
+	Sensitivity     float64       `json:"sensitivity,omitempty"`      // Multiplier applied to the input first, 0 means 1.0
+
+	// CircularGate maps the square of independent X and Y values onto the circle reachable by a
+	// physical joystick, e.g. (1, 1) becomes (0.707, 0.707). It is applied before the deadzone.
+	CircularGate bool `json:"circular_gate,omitempty"`
+
+	// Snap snaps the joystick to the nearest of 4 or 8 directions, keeping its magnitude.
+	// It is applied after the deadzone.
+	Snap SnapMode `json:"snap,omitempty"`
+
+	// SnapHysteresis is the angle, in degrees, by which the joystick must go past the boundary
+	// between two directions to leave the current one, so that it does not flicker around the boundary
+	SnapHysteresis float64 `json:"snap_hysteresis,omitempty"`
+}
+
+// TriggerProcessing configures how float trigger values are processed before being
+// written to the report. The zero value leaves them untouched.
+type TriggerProcessing struct {
+	Deadzone        float64 `json:"deadzone,omitempty"`         // Input value (0.0-1.0) under which the trigger stays released
+	AntiDeadzone    float64 `json:"anti_deadzone,omitempty"`    // Output value (0.0-1.0) of the smallest input past the deadzone, e.g. the deadzone of the game
+	OuterSaturation float64 `json:"outer_saturation,omitempty"` // Input value (0.0-1.0) from which the output is full, 0 means 1.0
+	Sensitivity     float64 `json:"sensitivity,omitempty"`      // Multiplier applied to the input first, 0 means 1.0
+}
+
+// remapMagnitude applies sensitivity, deadzone, anti-deadzone and outer saturation to a magnitude (>= 0).
+// Past the outer saturation, the result is 1.0, so that a radial joystick keeps its direction on the circle.
+func remapMagnitude(m, deadzone, antiDeadzone, saturation, sensitivity float64) float64 {
+	if sensitivity != 0 {
+		m *= sensitivity
+	}
+	if saturation <= 0 || saturation > 1 {
+		saturation = 1
+	}
+	if m <= deadzone {
+		return 0
+	}
+	if deadzone >= saturation {
+		return 1
+	}
+	t := (m - deadzone) / (saturation - deadzone)
+	return math.Min(antiDeadzone+(1-antiDeadzone)*t, 1)
+}
+
+// gate maps joystick values from the square onto the circle
+func gate(x, y float64) (float64, float64) {
+	x, y = clampFloat(x, -1, 1), clampFloat(y, -1, 1)
+	return x * math.Sqrt(1-y*y/2), y * math.Sqrt(1-x*x/2)
+}
+
+// apply processes joystick values, except for snapping, which needs the state of the pipeline
+func (p StickProcessing) apply(x, y float64) (float64, float64) {
+	if p.CircularGate {
+		x, y = gate(x, y)
+	}
+	if p.Deadzone == 0 && p.AntiDeadzone == 0 && p.OuterSaturation == 0 && p.Sensitivity == 0 {
+		return x, y
+	}
+	if p.Shape == DeadzoneAxial {
+		return p.axis(x), p.axis(y)
+	}
+	m := math.Hypot(x, y)
+	if m == 0 || math.IsNaN(m) {
+		return 0, 0
+	}
+	k := remapMagnitude(m, p.Deadzone, p.AntiDeadzone, p.OuterSaturation, p.Sensitivity) / m
+	return x * k, y * k
+}
+
+// axis processes a single joystick axis (axial deadzone)
+func (p StickProcessing) axis(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Copysign(remapMagnitude(math.Abs(v), p.Deadzone, p.AntiDeadzone, p.OuterSaturation, p.Sensitivity), v)
+}
+
+// apply processes a trigger value
+func (p TriggerProcessing) apply(v float64) float64 {
+	if p == (TriggerProcessing{}) {
+		return v
+	}
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	return remapMagnitude(v, p.Deadzone, p.AntiDeadzone, p.OuterSaturation, p.Sensitivity)
+}
+
+// SetLeftJoystickProcessing sets the processing applied by LeftJoystickFloat
+func (g *BaseGamepad) SetLeftJoystickProcessing(p StickProcessing) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.leftStick.processing = p
+	g.leftStick.snapped = false
+}
+
+// SetRightJoystickProcessing sets the processing applied by RightJoystickFloat
+func (g *BaseGamepad) SetRightJoystickProcessing(p StickProcessing) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rightStick.processing = p
+	g.rightStick.snapped = false
+}
+
+// SetLeftTriggerProcessing sets the processing applied by LeftTriggerFloat
+func (g *BaseGamepad) SetLeftTriggerProcessing(p TriggerProcessing) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.leftTrigger.processing = p
+}
+
+// SetRightTriggerProcessing sets the processing applied by RightTriggerFloat
+func (g *BaseGamepad) SetRightTriggerProcessing(p TriggerProcessing) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rightTrigger.processing = p
+}
+
+// stickPipeline holds everything applied to the float values of a joystick
+type stickPipeline struct {
+	curveX, curveY *Curve // nil for linear
+	processing     StickProcessing
+	snapped        bool // Whether sector holds the direction the joystick is snapped to
+	sector         int
+	in, out        [2]float64 // Last values given to apply and returned by it
+}
+
+// readTolerance is the largest error of a float value read back from a report (half a step of a DS4 axis)
+const readTolerance = 0.5 / 127
+
+// apply runs the float values of a joystick through the pipeline
+func (p *stickPipeline) apply(x, y float64) (float64, float64) {
+	p.in = [2]float64{x, y}
+	x, y = p.curveX.applyStick(x), p.curveY.applyStick(y)
+	x, y = p.processing.apply(x, y)
+	x, y = p.snap(x, y)
+	p.out = [2]float64{x, y}
+	return x, y
+}
+
+// source returns the values that, given to apply, put the joystick where the report has it (x, y):
+// the last input if the report still holds its output, x and y themselves otherwise (e.g. after a raw setter)
+func (p *stickPipeline) source(x, y float64) (float64, float64) {
+	if math.Abs(x-p.out[0]) <= readTolerance && math.Abs(y-p.out[1]) <= readTolerance {
+		return p.in[0], p.in[1]
+	}
+	return x, y
+}
+
+// snap snaps joystick values to the nearest direction, with hysteresis
+func (p *stickPipeline) snap(x, y float64) (float64, float64) {
+	var n int
+	switch p.processing.Snap {
+	case Snap4Way:
+		n = 4
+	case Snap8Way:
+		n = 8
+	default:
+		return x, y
+	}
+	m := math.Hypot(x, y)
+	if m == 0 || math.IsNaN(m) {
+		p.snapped = false
+		return 0, 0
+	}
+
+	width := 2 * math.Pi / float64(n)
+	angle := math.Atan2(y, x)
+	if p.snapped {
+		// Distance to the center of the current direction, in [-pi, pi]
+		d := math.Remainder(angle-float64(p.sector)*width, 2*math.Pi)
+		if math.Abs(d) > width/2+p.processing.SnapHysteresis*math.Pi/180 {
+			p.snapped = false
+		}
+	}
+	if !p.snapped {
+		p.sector = int(math.Round(angle/width)+float64(n)) % n
+		p.snapped = true
+	}
+
+	angle = float64(p.sector) * width
+	return m * math.Cos(angle), m * math.Sin(angle)
+}
+
+// triggerPipeline holds everything applied to the float value of a trigger
+type triggerPipeline struct {
+	curve      *Curve // nil for linear
+	processing TriggerProcessing
+	in, out    float64 // Last value given to apply and returned by it
+}
+
+// apply runs the float value of a trigger through the pipeline
+func (p *triggerPipeline) apply(v float64) float64 {
+	p.in = v
+	p.out = p.processing.apply(p.curve.applyTrigger(v))
+	return p.out
+}
+
+// source is stickPipeline.source for a trigger
+func (p *triggerPipeline) source(v float64) float64 {
+	if math.Abs(v-p.out) <= readTolerance {
+		return p.in
+	}
+	return v
+}
@@ -0,0 +1,254 @@
+package vgamepad
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestRemapMagnitudeIsContinuousAndMonotonic(t *testing.T) {
+	settings := [][4]float64{ // deadzone, anti-deadzone, outer saturation, sensitivity
+		{0.2, 0, 0, 0},
+		{0.2, 0.3, 0, 0},
+		{0.1, 0.25, 0.8, 0},
+		{0, 0, 0, 2},
+		{0.15, 0.2, 0.9, 1.5},
+	}
+	for _, s := range settings {
+		previous := 0.0
+		for i := 0; i <= 1000; i++ {
+			m := float64(i) / 1000
+			got := remapMagnitude(m, s[0], s[1], s[2], s[3])
+			if got < previous || got > 1 {
+				t.Fatalf("%v: remapMagnitude(%v) = %v after %v", s, m, got, previous)
+			}
+			previous = got
+		}
+		if previous != 1 {
+			t.Errorf("%v: full input = %v, want 1", s, previous)
+		}
+	}
+
+	// The anti-deadzone is where the output starts, right past the deadzone
+	if got := remapMagnitude(0.2+1e-12, 0.2, 0.3, 0, 0); !approx(got, 0.3) {
+		t.Errorf("just past the deadzone = %v, want the anti-deadzone 0.3", got)
+	}
+	if got := remapMagnitude(0.2, 0.2, 0.3, 0, 0); got != 0 {
+		t.Errorf("on the deadzone = %v, want 0", got)
+	}
+	// A deadzone reaching the outer saturation is a switch
+	if a, b := remapMagnitude(0.5, 0.6, 0, 0.6, 0), remapMagnitude(0.7, 0.6, 0, 0.6, 0); a != 0 || b != 1 {
+		t.Errorf("deadzone = saturation: %v below and %v above, want 0 and 1", a, b)
+	}
+}
+
+func TestRadialDeadzoneKeepsTheDirection(t *testing.T) {
+	p := StickProcessing{Deadzone: 0.2, AntiDeadzone: 0.1, Sensitivity: 3}
+	for angle := 0.0; angle < 360; angle += 15 {
+		x, y := math.Cos(angle*math.Pi/180)*0.7, math.Sin(angle*math.Pi/180)*0.7
+		px, py := p.apply(x, y)
+		// Sensitivity pushes the magnitude past 1: it is capped without bending the direction
+		if m := math.Hypot(px, py); !approx(m, 1) {
+			t.Errorf("%v°: magnitude %v, want 1", angle, m)
+		}
+		if !approx(math.Atan2(py, px), math.Atan2(y, x)) {
+			t.Errorf("%v°: (%v, %v) became (%v, %v)", angle, x, y, px, py)
+		}
+	}
+
+	if x, y := p.apply(math.NaN(), 0.5); x != 0 || y != 0 {
+		t.Errorf("apply(NaN, 0.5) = %v, %v, want neutral", x, y)
+	}
+}
+
+func TestAxialDeadzone(t *testing.T) {
+	p := StickProcessing{Deadzone: 0.25, Shape: DeadzoneAxial}
+
+	// Each axis has its own deadzone: a diagonal close to an axis is pulled onto it
+	x, y := p.apply(0.9, -0.2)
+	if !approx(x, 0.65/0.75) || y != 0 {
+		t.Errorf("apply(0.9, -0.2) = %v, %v, want %v, 0", x, y, 0.65/0.75)
+	}
+	// Whereas a radial deadzone keeps it off the axis
+	p.Shape = DeadzoneRadial
+	if _, y := p.apply(0.9, -0.2); y >= 0 {
+		t.Errorf("radial apply(0.9, -0.2) Y = %v, want negative", y)
+	}
+
+	p.Shape = DeadzoneAxial
+	if x, y := p.apply(-1, math.NaN()); x != -1 || y != 0 {
+		t.Errorf("apply(-1, NaN) = %v, %v, want -1, 0", x, y)
+	}
+}
+
+func TestTriggerProcessing(t *testing.T) {
+	var none TriggerProcessing
+	if v := none.apply(0.37); v != 0.37 {
+		t.Errorf("zero value apply(0.37) = %v", v)
+	}
+
+	p := TriggerProcessing{Deadzone: 0.1, AntiDeadzone: 0.2, OuterSaturation: 0.9}
+	for v, want := range map[float64]float64{-0.5: 0, 0.1: 0, 0.5: 0.6, 0.9: 1, 1: 1} {
+		if got := p.apply(v); !approx(got, want) {
+			t.Errorf("apply(%v) = %v, want %v", v, got, want)
+		}
+	}
+	if got := p.apply(math.NaN()); got != 0 {
+		t.Errorf("apply(NaN) = %v, want 0", got)
+	}
+}
+
+func TestProcessingThroughTheSetters(t *testing.T) {
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+	g.SetLeftJoystickProcessing(StickProcessing{Deadzone: 0.3})
+	g.SetRightTriggerProcessing(TriggerProcessing{Deadzone: 0.5})
+
+	// Jitter around the center and a trigger resting on the finger stay neutral
+	g.LeftJoystickFloat(0.2, -0.2)
+	g.RightTriggerFloat(0.4)
+	if r := g.GetReport(); r.BThumbLX != 128 || r.BThumbLY != 128 || r.BTriggerR != 0 {
+		t.Errorf("inside the deadzones: left stick %d, %d, right trigger %d", r.BThumbLX, r.BThumbLY, r.BTriggerR)
+	}
+
+	// The other controls are not processed
+	g.RightJoystickFloat(0.2, 0)
+	g.LeftTriggerFloat(0.4)
+	if r := g.GetReport(); r.BThumbRX == 128 || r.BTriggerL == 0 {
+		t.Errorf("unprocessed controls: right stick X %d, left trigger %d", r.BThumbRX, r.BTriggerL)
+	}
+}
+
+func TestDeadzoneShapeJSON(t *testing.T) {
+	data, err := json.Marshal(StickProcessing{Deadzone: 0.1, Shape: DeadzoneAxial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"deadzone":0.1,"shape":"axial"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	var p StickProcessing
+	if err := json.Unmarshal([]byte(`{"shape":"square"}`), &p); err == nil {
+		t.Error("Unmarshal of an unknown shape succeeded")
+	}
+	if _, err := DeadzoneShape(7).MarshalText(); err == nil {
+		t.Error("MarshalText of an invalid shape succeeded")
+	}
+}
+
+func TestGateReachesTheCircle(t *testing.T) {
+	// The edges of the square land on the circle, the axes are untouched
+	for i := -10; i <= 10; i++ {
+		v := float64(i) / 10
+		for _, corner := range [][2]float64{{1, v}, {-1, v}, {v, 1}, {v, -1}} {
+			x, y := gate(corner[0], corner[1])
+			if m := math.Hypot(x, y); !approx(m, 1) {
+				t.Errorf("gate(%v, %v) = %v, %v, magnitude %v, want 1", corner[0], corner[1], x, y, m)
+			}
+		}
+		if x, y := gate(v, 0); !approx(x, v) || y != 0 {
+			t.Errorf("gate(%v, 0) = %v, %v", v, x, y)
+		}
+	}
+	// Values outside of the square are clamped first
+	if x, y := gate(3, -3); !approx(x, math.Sqrt(0.5)) || !approx(y, -math.Sqrt(0.5)) {
+		t.Errorf("gate(3, -3) = %v, %v", x, y)
+	}
+}
+
+func TestGateBeforeDeadzone(t *testing.T) {
+	// A full diagonal needs the gate to keep the magnitude of a full push once the deadzone is applied
+	p := StickProcessing{CircularGate: true, Deadzone: 0.1}
+	x, y := p.apply(1, 1)
+	if !approx(math.Hypot(x, y), 1) || !approx(x, y) {
+		t.Errorf("apply(1, 1) = %v, %v, want a full push at 45°", x, y)
+	}
+}
+
+// polar returns the joystick values at an angle (degrees) and magnitude
+func polar(angle, m float64) (float64, float64) {
+	return m * math.Cos(angle*math.Pi/180), m * math.Sin(angle*math.Pi/180)
+}
+
+// snappedAngle returns the angle (degrees, 0 to 360) the pipeline snaps the joystick to
+func snappedAngle(p *stickPipeline, angle float64) float64 {
+	x, y := p.snap(polar(angle, 0.6))
+	a := math.Round(math.Atan2(y, x) * 180 / math.Pi)
+	if a < 0 {
+		a += 360
+	}
+	return a
+}
+
+func TestSnapSectors(t *testing.T) {
+	for _, tt := range []struct {
+		mode SnapMode
+		n    int
+	}{{Snap4Way, 4}, {Snap8Way, 8}} {
+		width := 360 / float64(tt.n)
+		for angle := -180.0; angle < 540; angle += 5 {
+			p := &stickPipeline{processing: StickProcessing{Snap: tt.mode}}
+			got := snappedAngle(p, angle)
+			// The snapped direction is the nearest one, also across the wrap around 0°
+			if d := math.Abs(math.Remainder(got-angle, 360)); d > width/2 {
+				t.Errorf("%d-way: %v° snapped to %v°", tt.n, angle, got)
+			}
+			if math.Mod(got, width) != 0 {
+				t.Errorf("%d-way: %v° snapped to %v°, not a direction", tt.n, angle, got)
+			}
+		}
+	}
+
+	// The magnitude is kept
+	p := &stickPipeline{processing: StickProcessing{Snap: Snap8Way}}
+	if x, y := p.snap(0.3, 0.1); !approx(math.Hypot(x, y), math.Hypot(0.3, 0.1)) {
+		t.Errorf("snap(0.3, 0.1) = %v, %v", x, y)
+	}
+}
+
+func TestSnapHysteresis(t *testing.T) {
+	p := &stickPipeline{processing: StickProcessing{Snap: Snap4Way, SnapHysteresis: 10}}
+
+	// Sweeping up from the right: the boundary at 45° is crossed at 55°, and back down at 35°
+	for _, step := range []struct{ angle, want float64 }{
+		{0, 0}, {44, 0}, {46, 0}, {54, 0}, {56, 90}, {46, 90}, {36, 90}, {34, 0},
+		// Across the wrap, from 0° to 315° and back
+		{-50, 0}, {-56, 270}, {-40, 270}, {-34, 0},
+	} {
+		if got := snappedAngle(p, step.angle); got != step.want {
+			t.Errorf("at %v°: snapped to %v°, want %v°", step.angle, got, step.want)
+		}
+	}
+
+	// Going through neutral forgets the direction
+	p.snap(polar(80, 1))
+	if x, y := p.snap(0, 0); x != 0 || y != 0 {
+		t.Errorf("snap(0, 0) = %v, %v", x, y)
+	}
+	if got := snappedAngle(p, 40); got != 0 {
+		t.Errorf("40° after neutral snapped to %v°, want 0°", got)
+	}
+
+	// And so does a new processing
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.SetLeftJoystickProcessing(StickProcessing{Snap: Snap4Way, SnapHysteresis: 30})
+	g.LeftJoystickFloat(polar(80, 1))
+	g.SetLeftJoystickProcessing(StickProcessing{Snap: Snap4Way, SnapHysteresis: 30})
+	g.LeftJoystickFloat(polar(30, 1))
+	if r := g.GetReport(); r.SThumbLX != 32767 || r.SThumbLY != 0 {
+		t.Errorf("30° after SetLeftJoystickProcessing = %d, %d, want right", r.SThumbLX, r.SThumbLY)
+	}
+}
+
+func TestSnapModeJSON(t *testing.T) {
+	var p StickProcessing
+	if err := json.Unmarshal([]byte(`{"circular_gate":true,"snap":"8-way","snap_hysteresis":5}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.CircularGate || p.Snap != Snap8Way || p.SnapHysteresis != 5 {
+		t.Errorf("Unmarshal = %+v", p)
+	}
+	if err := json.Unmarshal([]byte(`{"snap":"6-way"}`), &p); err == nil {
+		t.Error("Unmarshal of an unknown snap mode succeeded")
+	}
+}
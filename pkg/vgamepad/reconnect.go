@@ -0,0 +1,210 @@
+package vgamepad
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// reconnectEventQueue is the number of reconnect events a gamepad can have pending for its handler
+const reconnectEventQueue = 16
+
+// ReconnectEvent describes an attempt to plug a gamepad back after its target dropped from the bus
+type ReconnectEvent struct {
+	Attempt int   // Number of the attempt since the target dropped, from 1
+	Bus     bool  // Whether the bus had to be reconnected
+	Err     error // nil if the gamepad is plugged back, with its notifications and last report restored
+}
+
+// healer is the runtime state of the automatic reconnection of a gamepad
+type healer struct {
+	interval time.Duration
+	onEvent  func(event ReconnectEvent)
+	send     func() error        // Sends the current report (g.mu must be held)
+	events   chan ReconnectEvent // Events waiting for the handler
+	stop     chan struct{}       // Closed to stop the health checks
+	last     time.Time           // When reconnection was last attempted
+	attempts int                 // Failed attempts since the target dropped
+}
+
+// setAutoReconnect enables (or disables, if interval is 0) the automatic reconnection
+func (g *BaseGamepad) setAutoReconnect(interval time.Duration, onEvent func(event ReconnectEvent), send func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopHealer()
+	if interval <= 0 || g.devicep == 0 {
+		return
+	}
+	g.healer = &healer{
+		interval: interval,
+		onEvent:  onEvent,
+		send:     send,
+		events:   make(chan ReconnectEvent, reconnectEventQueue),
+		stop:     make(chan struct{}),
+	}
+	go g.healLoop(g.healer)
+}
+
+// stopHealer disables the automatic reconnection (g.mu must be held)
+func (g *BaseGamepad) stopHealer() {
+	if g.healer != nil {
+		close(g.healer.stop)
+	}
+	g.healer = nil
+}
+
+// healLoop checks that the target is attached every interval, and delivers the reconnect events
+func (g *BaseGamepad) healLoop(h *healer) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case event := <-h.events:
+			if h.onEvent != nil {
+				h.onEvent(event)
+			}
+		case <-ticker.C:
+			g.mu.Lock()
+			if g.healer == h && g.devicep != 0 && !g.client.TargetIsAttached(g.devicep) {
+				g.reattach(h)
+			}
+			g.mu.Unlock()
+		}
+	}
+}
+
+// selfHeal reattaches the target if err comes from an update of a target that dropped from
+// the bus, and returns the error of the update, or of the reattachment (g.mu must be held)
+func (g *BaseGamepad) selfHeal(err error) error {
+	h := g.healer
+	if err == nil || h == nil || g.devicep == 0 {
+		return err
+	}
+	if g.client.TargetIsAttached(g.devicep) && !isBusError(err) && !errors.Is(err, commons.VIGEM_ERROR_TARGET_NOT_PLUGGED_IN) {
+		return err
+	}
+	if time.Since(h.last) < h.interval {
+		// Leave the next attempt to the health checks rather than retrying on every Update
+		return err
+	}
+	return g.reattach(h)
+}
+
+// reattach replaces the dropped target with a new one of the same identity, restores its
+// notifications and its report, and queues a reconnect event (g.mu must be held)
+func (g *BaseGamepad) reattach(h *healer) error {
+	h.last = time.Now()
+	h.attempts++
+	event := ReconnectEvent{Attempt: h.attempts}
+
+	var notifyErr error
+	event.Bus, notifyErr, event.Err = g.replaceTarget()
+	if event.Err == nil {
+		h.attempts = 0
+		if notifyErr != nil {
+			event.Err = fmt.Errorf("failed to register notification: %w", notifyErr)
+		}
+		if err := h.send(); err != nil && event.Err == nil {
+			event.Err = fmt.Errorf("failed to restore the report: %w", err)
+		}
+	}
+
+	g.publish(EventReconnect, event.Err)
+	select {
+	case h.events <- event:
+	default:
+	}
+	return event.Err
+}
+
+// replaceTarget adds a new target with the identity of the current one to the bus, reconnecting
+// the bus if needed, moves the notification callback to it, makes it the target of the gamepad
+// and frees the old one. It returns an error if no target could be added; the old target is
+// then kept. A failure to register the callback again is returned as notifyErr (g.mu must be held)
+func (g *BaseGamepad) replaceTarget() (busReconnected bool, notifyErr error, err error) {
+	old := g.devicep
+	vid, pid := g.client.TargetGetVid(old), g.client.TargetGetPid(old)
+	devicep, err := g.alloc(g.client)
+	if err != nil {
+		return false, nil, err
+	}
+	setIdentity(g.client, devicep, vid, pid)
+
+	// Another gamepad may have reconnected the bus already
+	g.busGen = g.vbus.generation()
+	err = g.client.TargetAdd(g.busp, devicep)
+	if isBusError(err) {
+		g.busGen, err = g.vbus.reconnect(g.busGen)
+		if err == nil {
+			busReconnected = true
+			err = g.client.TargetAdd(g.busp, devicep)
+		}
+	}
+	if err == nil && !g.client.TargetIsAttached(devicep) {
+		err = fmt.Errorf("the virtual device could not connect to ViGEmBus")
+	}
+	if err != nil {
+		g.client.TargetFree(devicep)
+		return busReconnected, nil, err
+	}
+
+	g.devicep = devicep
+	g.cacheIdentity()
+	if g.cmpFunc != nil {
+		notifyErr = g.moveNotification(old)
+	}
+	g.client.TargetRemove(g.busp, old)
+	g.client.TargetFree(old)
+	return busReconnected, notifyErr, nil
+}
+
+// moveNotification unregisters the notification callback from the old target and
+// registers it on the current one (g.mu must be held)
+func (g *BaseGamepad) moveNotification(old uintptr) error {
+	switch g.client.TargetGetType(g.devicep) {
+	case commons.Xbox360Wired:
+		g.client.TargetX360UnregisterNotification(old)
+		return g.client.TargetX360RegisterNotification(g.busp, g.devicep, uintptr(g.cmpFunc), 0)
+	case commons.DualShock4Wired:
+		g.client.TargetDS4UnregisterNotification(old)
+		return g.client.TargetDS4RegisterNotification(g.busp, g.devicep, uintptr(g.cmpFunc), 0)
+	}
+	return nil
+}
+
+// isBusError reports whether an error means that the connection to the bus is lost
+func isBusError(err error) bool {
+	var vigemErr commons.ViGEmError
+	if !errors.As(err, &vigemErr) {
+		return false
+	}
+	switch vigemErr {
+	case commons.VIGEM_ERROR_BUS_NOT_FOUND, commons.VIGEM_ERROR_BUS_ACCESS_FAILED, commons.VIGEM_ERROR_BUS_INVALID_HANDLE:
+		return true
+	}
+	return false
+}
+
+// SetAutoReconnect enables the automatic reconnection of the gamepad: every interval, and when
+// Update fails, the target is checked, and if it dropped from the bus (e.g. the driver was
+// restarted), the bus is reconnected if needed and a new target with the same VID and PID is
+// plugged in, with the registered notification and the last report. onReconnect, if not nil,
+// is called with the result of each attempt. An interval of 0 disables it.
+func (g *VX360Gamepad) SetAutoReconnect(interval time.Duration, onReconnect func(event ReconnectEvent)) {
+	g.setAutoReconnect(interval, onReconnect, g.update)
+}
+
+// SetAutoReconnect enables the automatic reconnection of the gamepad: every interval, and when
+// Update fails, the target is checked, and if it dropped from the bus (e.g. the driver was
+// restarted), the bus is reconnected if needed and a new target with the same VID and PID is
+// plugged in, with the registered notification and the last report. onReconnect, if not nil,
+// is called with the result of each attempt. An interval of 0 disables it.
+func (g *VDS4Gamepad) SetAutoReconnect(interval time.Duration, onReconnect func(event ReconnectEvent)) {
+	g.setAutoReconnect(interval, onReconnect, g.update)
+}
@@ -0,0 +1,370 @@
+package vgamepad
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// AxisValue is the value an axis takes while a button is pressed
+type AxisValue struct {
+	Axis  Axis    `json:"axis"`
+	Value float64 `json:"value"` // -1.0 to 1.0 for joysticks, 0.0 to 1.0 for triggers
+}
+
+// AxisButton presses a button while an axis is past a threshold
+type AxisButton struct {
+	Axis Axis `json:"axis"`
+
+	// Threshold from which the button is pressed: a positive threshold is reached by values above it,
+	// a negative one by values below it (e.g. -0.5 on left_x presses the button when pushing left)
+	Threshold float64 `json:"threshold"`
+
+	Button Button `json:"button"`
+}
+
+// Layer is a set of mappings from logical inputs to the inputs of the gamepad.
+// Buttons that are not mapped are passed through.
+type Layer struct {
+	Buttons     map[Button]Button    `json:"buttons,omitempty"`      // Button to button, "none" disables the button
+	ButtonAxes  map[Button]AxisValue `json:"button_axes,omitempty"`  // Button to axis value, e.g. a digital trigger
+	AxisButtons []AxisButton         `json:"axis_buttons,omitempty"` // Axis to button, the axis itself stays neutral
+	SwapSticks  bool                 `json:"swap_sticks,omitempty"`  // Swaps the left and right joysticks
+	Invert      []Axis               `json:"invert,omitempty"`       // Axes to invert, after swapping the joysticks
+}
+
+// ModifierLayer is a layer active while its modifier button is held, or toggled by it.
+// Modifier buttons are not passed to the gamepad.
+type ModifierLayer struct {
+	Modifier Button `json:"modifier"`
+	Toggle   bool   `json:"toggle,omitempty"` // Whether pressing the modifier turns the layer on and off, instead of holding it
+	Layer
+}
+
+// Profile is a remapping profile: a base layer and modifier layers on top of it.
+// Button mappings of an active modifier layer override the layers below it, while
+// the axis mappings, swaps and inversions of all active layers add up.
+type Profile struct {
+	Layer
+	Layers []ModifierLayer `json:"layers,omitempty"`
+}
+
+// LoadProfile reads a JSON profile from a file
+func LoadProfile(path string) (Profile, error) {
+	var profile Profile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return profile, fmt.Errorf("failed to read profile: %w", err)
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("failed to parse profile %s: %w", path, err)
+	}
+	if err := profile.Validate(); err != nil {
+		return profile, fmt.Errorf("invalid profile %s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// Validate returns an error if the profile is not usable
+func (p Profile) Validate() error {
+	if err := p.Layer.validate(); err != nil {
+		return err
+	}
+	for i, l := range p.Layers {
+		if _, ok := buttonNames[l.Modifier]; !ok {
+			return fmt.Errorf("layer %d: modifier must be a single button, got %v", i, l.Modifier)
+		}
+		if err := l.Layer.validate(); err != nil {
+			return fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validate returns an error if the layer is not usable
+func (l Layer) validate() error {
+	for from, to := range l.Buttons {
+		if _, ok := buttonNames[from]; !ok {
+			return fmt.Errorf("invalid button %v", from)
+		}
+		if _, ok := buttonNames[to]; !ok && to != 0 {
+			return fmt.Errorf("invalid button %v mapped from %v", to, from)
+		}
+	}
+	for from, to := range l.ButtonAxes {
+		if _, ok := buttonNames[from]; !ok {
+			return fmt.Errorf("invalid button %v", from)
+		}
+		if err := checkAxisValue(to.Axis, to.Value); err != nil {
+			return fmt.Errorf("%v: %w", from, err)
+		}
+	}
+	for _, m := range l.AxisButtons {
+		if err := checkAxisValue(m.Axis, m.Threshold); err != nil || m.Threshold == 0 {
+			return fmt.Errorf("invalid threshold %v for axis %v", m.Threshold, m.Axis)
+		}
+		if _, ok := buttonNames[m.Button]; !ok {
+			return fmt.Errorf("invalid button %v mapped from %v", m.Button, m.Axis)
+		}
+	}
+	for _, axis := range l.Invert {
+		if axis < 0 || axis >= axisCount {
+			return fmt.Errorf("invalid axis %d", int(axis))
+		}
+	}
+	return nil
+}
+
+// checkAxisValue returns an error if value is not a valid value for axis
+func checkAxisValue(axis Axis, value float64) error {
+	min := -1.0
+	switch axis {
+	case AxisLeftX, AxisLeftY, AxisRightX, AxisRightY:
+	case AxisLeftTrigger, AxisRightTrigger:
+		min = 0
+	default:
+		return fmt.Errorf("invalid axis %d", int(axis))
+	}
+	if !(value >= min && value <= 1) {
+		return fmt.Errorf("value %v out of range [%v, 1] for axis %v", value, min, axis)
+	}
+	return nil
+}
+
+// Remapper is a Controller that remaps its inputs, following a profile, before passing
+// them to another Controller. Update, Reset and the other Gamepad methods go to that controller.
+type Remapper struct {
+	Controller // Gamepad receiving the remapped inputs
+
+	mu      sync.Mutex
+	profile Profile
+	toggled []bool             // Whether each toggle layer is on
+	pressed Button             // Logical buttons held
+	axes    [axisCount]float64 // Logical axes
+	out     Button             // Buttons pressed on the gamepad
+	outAxes [axisCount]float64 // Axes set on the gamepad
+}
+
+var _ Controller = (*Remapper)(nil)
+
+// NewRemapper creates a Remapper sending remapped inputs to target
+func NewRemapper(target Controller, profile Profile) (*Remapper, error) {
+	r := &Remapper{Controller: target}
+	if err := r.SetProfile(profile); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetProfile replaces the profile, turning the toggle layers off, and remaps the current inputs
+func (r *Remapper) SetProfile(profile Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.profile = profile
+	r.toggled = make([]bool, len(profile.Layers))
+	r.apply()
+	return nil
+}
+
+// GetProfile returns the profile
+func (r *Remapper) GetProfile() Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.profile
+}
+
+// Press presses logical buttons (no effect if already pressed)
+func (r *Remapper) Press(button Button) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pressed := button &^ r.pressed
+	for i, l := range r.profile.Layers {
+		if l.Toggle && pressed&l.Modifier != 0 {
+			r.toggled[i] = !r.toggled[i]
+		}
+	}
+	r.pressed |= button
+	r.apply()
+}
+
+// Release releases logical buttons (no effect if already released)
+func (r *Remapper) Release(button Button) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pressed &^= button
+	r.apply()
+}
+
+// LeftTriggerFloat sets the logical value (0.0-1.0, 0.0 = trigger released) of the left trigger
+func (r *Remapper) LeftTriggerFloat(valueFloat float64) {
+	r.setAxes(map[Axis]float64{AxisLeftTrigger: valueFloat})
+}
+
+// RightTriggerFloat sets the logical value (0.0-1.0, 0.0 = trigger released) of the right trigger
+func (r *Remapper) RightTriggerFloat(valueFloat float64) {
+	r.setAxes(map[Axis]float64{AxisRightTrigger: valueFloat})
+}
+
+// LeftJoystickFloat sets the logical values (-1.0 to 1.0, 0 = neutral position) of the left joystick
+func (r *Remapper) LeftJoystickFloat(xValueFloat, yValueFloat float64) {
+	r.setAxes(map[Axis]float64{AxisLeftX: xValueFloat, AxisLeftY: yValueFloat})
+}
+
+// RightJoystickFloat sets the logical values (-1.0 to 1.0, 0 = neutral position) of the right joystick
+func (r *Remapper) RightJoystickFloat(xValueFloat, yValueFloat float64) {
+	r.setAxes(map[Axis]float64{AxisRightX: xValueFloat, AxisRightY: yValueFloat})
+}
+
+// setAxes sets logical axes and remaps them
+func (r *Remapper) setAxes(values map[Axis]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for axis, value := range values {
+		if axis.isTrigger() {
+			r.axes[axis] = clampFloat(value, 0, 1)
+		} else {
+			r.axes[axis] = clampFloat(value, -1, 1)
+		}
+	}
+	r.apply()
+}
+
+// Reset releases all logical inputs, turns the toggle layers off and resets the gamepad,
+// then remaps the inputs at rest, e.g. so that an inverted trigger is fully pressed
+func (r *Remapper) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.toggled = make([]bool, len(r.profile.Layers))
+	r.pressed = 0
+	r.axes = [axisCount]float64{}
+	r.out = 0
+	r.outAxes = [axisCount]float64{}
+	r.Controller.Reset()
+	r.apply()
+}
+
+// isTrigger reports whether the axis is a trigger
+func (a Axis) isTrigger() bool {
+	return a == AxisLeftTrigger || a == AxisRightTrigger
+}
+
+// activeLayers returns the active layers, from the base layer up (r.mu must be held)
+func (r *Remapper) activeLayers() []*Layer {
+	layers := []*Layer{&r.profile.Layer}
+	for i := range r.profile.Layers {
+		l := &r.profile.Layers[i]
+		if (l.Toggle && r.toggled[i]) || (!l.Toggle && r.pressed&l.Modifier != 0) {
+			layers = append(layers, &l.Layer)
+		}
+	}
+	return layers
+}
+
+// apply remaps the logical inputs and sets the changes on the gamepad (r.mu must be held)
+func (r *Remapper) apply() {
+	layers := r.activeLayers()
+	axes := r.axes
+
+	swap := false
+	var inverted [axisCount]bool
+	for _, l := range layers {
+		swap = swap || l.SwapSticks
+		for _, axis := range l.Invert {
+			inverted[axis] = true
+		}
+	}
+	if swap {
+		axes[AxisLeftX], axes[AxisRightX] = axes[AxisRightX], axes[AxisLeftX]
+		axes[AxisLeftY], axes[AxisRightY] = axes[AxisRightY], axes[AxisLeftY]
+	}
+	for axis, invert := range inverted {
+		if !invert {
+			continue
+		}
+		if Axis(axis).isTrigger() {
+			axes[axis] = 1 - axes[axis]
+		} else {
+			axes[axis] = -axes[axis]
+		}
+	}
+
+	var buttons Button
+	var consumed [axisCount]bool
+	for _, l := range layers {
+		for _, m := range l.AxisButtons {
+			consumed[m.Axis] = true
+			if v := axes[m.Axis]; (m.Threshold > 0 && v >= m.Threshold) || (m.Threshold < 0 && v <= m.Threshold) {
+				buttons |= m.Button
+			}
+		}
+	}
+	for axis := range consumed {
+		if consumed[axis] {
+			axes[axis] = 0
+		}
+	}
+
+	var modifiers Button
+	for _, l := range r.profile.Layers {
+		modifiers |= l.Modifier
+	}
+	for _, b := range standardButtons {
+		if r.pressed&^modifiers&b == 0 {
+			continue
+		}
+		if to, value, ok := lookupButton(layers, b); !ok {
+			buttons |= b
+		} else if value != nil {
+			axes[value.Axis] = value.Value
+		} else {
+			buttons |= to
+		}
+	}
+
+	if pressed := buttons &^ r.out; pressed != 0 {
+		r.Controller.Press(pressed)
+	}
+	if released := r.out &^ buttons; released != 0 {
+		r.Controller.Release(released)
+	}
+	r.out = buttons
+
+	if axes[AxisLeftTrigger] != r.outAxes[AxisLeftTrigger] {
+		r.Controller.LeftTriggerFloat(axes[AxisLeftTrigger])
+	}
+	if axes[AxisRightTrigger] != r.outAxes[AxisRightTrigger] {
+		r.Controller.RightTriggerFloat(axes[AxisRightTrigger])
+	}
+	if axes[AxisLeftX] != r.outAxes[AxisLeftX] || axes[AxisLeftY] != r.outAxes[AxisLeftY] {
+		r.Controller.LeftJoystickFloat(axes[AxisLeftX], axes[AxisLeftY])
+	}
+	if axes[AxisRightX] != r.outAxes[AxisRightX] || axes[AxisRightY] != r.outAxes[AxisRightY] {
+		r.Controller.RightJoystickFloat(axes[AxisRightX], axes[AxisRightY])
+	}
+	r.outAxes = axes
+}
+
+// lookupButton returns the mapping of a button in the topmost layer mapping it,
+// either to a button or to an axis value, or false if no layer maps it
+func lookupButton(layers []*Layer, button Button) (Button, *AxisValue, bool) {
+	for i := len(layers) - 1; i >= 0; i-- {
+		if to, ok := layers[i].Buttons[button]; ok {
+			return to, nil, true
+		}
+		if value, ok := layers[i].ButtonAxes[button]; ok {
+			return 0, &value, true
+		}
+	}
+	return 0, nil, false
+}
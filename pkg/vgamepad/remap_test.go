@@ -0,0 +1,247 @@
+package vgamepad
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeController records the inputs it receives, without a virtual device.
+// Methods it does not override panic on the nil embedded Controller.
+type fakeController struct {
+	Controller
+	buttons Button
+	axes    [axisCount]float64
+	calls   []string // Calls received, e.g. "Press(south)"
+}
+
+// record appends a call to calls
+func (f *fakeController) record(format string, args ...interface{}) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeController) Press(button Button) {
+	f.buttons |= button
+	f.record("Press(%v)", button)
+}
+
+func (f *fakeController) Release(button Button) {
+	f.buttons &^= button
+	f.record("Release(%v)", button)
+}
+
+func (f *fakeController) LeftTriggerFloat(valueFloat float64) {
+	f.axes[AxisLeftTrigger] = valueFloat
+	f.record("LeftTriggerFloat(%v)", valueFloat)
+}
+
+func (f *fakeController) RightTriggerFloat(valueFloat float64) {
+	f.axes[AxisRightTrigger] = valueFloat
+	f.record("RightTriggerFloat(%v)", valueFloat)
+}
+
+func (f *fakeController) LeftJoystickFloat(xValueFloat, yValueFloat float64) {
+	f.axes[AxisLeftX], f.axes[AxisLeftY] = xValueFloat, yValueFloat
+	f.record("LeftJoystickFloat(%v, %v)", xValueFloat, yValueFloat)
+}
+
+func (f *fakeController) RightJoystickFloat(xValueFloat, yValueFloat float64) {
+	f.axes[AxisRightX], f.axes[AxisRightY] = xValueFloat, yValueFloat
+	f.record("RightJoystickFloat(%v, %v)", xValueFloat, yValueFloat)
+}
+
+func (f *fakeController) Reset() {
+	f.buttons = 0
+	f.axes = [axisCount]float64{}
+	f.record("Reset()")
+}
+
+// newTestRemapper returns a remapper over a fake controller, failing the test if the profile is invalid
+func newTestRemapper(t *testing.T, profile Profile) (*Remapper, *fakeController) {
+	t.Helper()
+	f := &fakeController{}
+	r, err := NewRemapper(f, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.calls = nil
+	return r, f
+}
+
+func TestRemapperForwardsOnlyChanges(t *testing.T) {
+	r, f := newTestRemapper(t, Profile{Layer: Layer{Buttons: map[Button]Button{ButtonSouth: ButtonEast}}})
+
+	r.Press(ButtonSouth | ButtonStart)
+	r.Press(ButtonSouth) // Already held
+	r.LeftJoystickFloat(0.5, 0)
+	r.RightTriggerFloat(0.25)
+	r.Release(ButtonStart)
+	want := []string{
+		"Press(Button(0x102))", // East and start in one call
+		"LeftJoystickFloat(0.5, 0)",
+		"RightTriggerFloat(0.25)",
+		"Release(start)",
+	}
+	if !reflect.DeepEqual(f.calls, want) {
+		t.Errorf("calls = %q, want %q", f.calls, want)
+	}
+}
+
+func TestRemapperSharedTarget(t *testing.T) {
+	// Two logical buttons on the same gamepad button: it stays pressed until both are released
+	r, f := newTestRemapper(t, Profile{Layer: Layer{Buttons: map[Button]Button{ButtonSouth: ButtonEast, ButtonWest: ButtonEast}}})
+
+	r.Press(ButtonSouth)
+	r.Press(ButtonWest)
+	r.Release(ButtonSouth)
+	if f.buttons != ButtonEast {
+		t.Errorf("one of two held = %v, want east", f.buttons)
+	}
+	r.Release(ButtonWest)
+	if f.buttons != 0 {
+		t.Errorf("both released = %v", f.buttons)
+	}
+
+	// "none" disables a button altogether
+	r, f = newTestRemapper(t, Profile{Layer: Layer{Buttons: map[Button]Button{ButtonHome: 0}}})
+	r.Press(ButtonHome)
+	if len(f.calls) != 0 {
+		t.Errorf("disabled button sent %q", f.calls)
+	}
+}
+
+func TestModifierLayers(t *testing.T) {
+	r, f := newTestRemapper(t, Profile{Layers: []ModifierLayer{
+		{Modifier: ButtonLeftBumper, Layer: Layer{Buttons: map[Button]Button{ButtonSouth: ButtonNorth}}},
+		{Modifier: ButtonSelect, Toggle: true, Layer: Layer{SwapSticks: true}},
+	}})
+
+	// Releasing the modifier while the button is held moves it back to its base mapping
+	r.Press(ButtonLeftBumper)
+	r.Press(ButtonSouth)
+	if f.buttons != ButtonNorth {
+		t.Errorf("with the modifier = %v, want north only (the modifier is not sent)", f.buttons)
+	}
+	r.Release(ButtonLeftBumper)
+	if f.buttons != ButtonSouth {
+		t.Errorf("modifier released = %v, want south", f.buttons)
+	}
+
+	// A toggle changes on each new press, not on repeated presses while held
+	r.LeftJoystickFloat(0.3, 0.4)
+	r.Press(ButtonSelect)
+	r.Press(ButtonSelect)
+	if f.axes[AxisRightX] != 0.3 || f.axes[AxisLeftX] != 0 {
+		t.Errorf("toggled on: axes %v, want the sticks swapped", f.axes)
+	}
+	r.Release(ButtonSelect)
+	r.Press(ButtonSelect)
+	if f.axes[AxisLeftX] != 0.3 {
+		t.Errorf("toggled off: axes %v", f.axes)
+	}
+
+	// A new profile turns the toggles off
+	r.Release(ButtonSelect)
+	r.Press(ButtonSelect)
+	r.SetProfile(r.GetProfile())
+	if f.axes[AxisLeftX] != 0.3 || f.axes[AxisRightX] != 0 {
+		t.Errorf("after SetProfile: axes %v", f.axes)
+	}
+}
+
+func TestAxisMappings(t *testing.T) {
+	r, f := newTestRemapper(t, Profile{Layer: Layer{
+		AxisButtons: []AxisButton{
+			{Axis: AxisRightY, Threshold: -0.5, Button: ButtonRightStick},
+			{Axis: AxisRightY, Threshold: 0.5, Button: ButtonNorth},
+		},
+		ButtonAxes: map[Button]AxisValue{ButtonWest: {Axis: AxisRightX, Value: -1}},
+		Invert:     []Axis{AxisRightTrigger},
+	}})
+
+	// The mapped axis stays neutral, the other axis of the joystick still moves
+	r.RightJoystickFloat(0.2, -0.5)
+	if f.buttons != ButtonRightStick || f.axes[AxisRightY] != 0 || f.axes[AxisRightX] != 0.2 {
+		t.Errorf("on the negative threshold: buttons %v, axes %v", f.buttons, f.axes)
+	}
+	r.RightJoystickFloat(0.2, 0.49)
+	if f.buttons != 0 {
+		t.Errorf("under the positive threshold: buttons %v", f.buttons)
+	}
+
+	// A button setting an axis overrides the logical value of the axis, which comes back on release
+	r.Press(ButtonWest)
+	if f.axes[AxisRightX] != -1 || f.buttons != 0 {
+		t.Errorf("west held: axes %v, buttons %v", f.axes, f.buttons)
+	}
+	r.Release(ButtonWest)
+	if f.axes[AxisRightX] != 0.2 {
+		t.Errorf("west released: right X %v, want 0.2", f.axes[AxisRightX])
+	}
+
+	// Inverted triggers are clamped first
+	r.RightTriggerFloat(1.5)
+	if f.axes[AxisRightTrigger] != 0 {
+		t.Errorf("inverted trigger at 1.5 = %v, want 0", f.axes[AxisRightTrigger])
+	}
+}
+
+func TestRemapperResetInvertedTrigger(t *testing.T) {
+	r, f := newTestRemapper(t, Profile{Layer: Layer{Invert: []Axis{AxisLeftTrigger}}})
+	r.LeftTriggerFloat(1)
+	r.Press(ButtonSouth)
+	f.calls = nil
+
+	r.Reset()
+	// The gamepad is reset first, then the inputs at rest are remapped
+	want := []string{"Reset()", "LeftTriggerFloat(1)"}
+	if !reflect.DeepEqual(f.calls, want) {
+		t.Errorf("calls = %q, want %q", f.calls, want)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profile.json")
+	os.WriteFile(path, []byte(`{
+		"buttons": {"south": "east", "home": "none"},
+		"layers": [{"modifier": "left_bumper", "toggle": true, "invert": ["left_y"]}]
+	}`), 0o644)
+
+	profile, err := LoadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Buttons[ButtonSouth] != ButtonEast || profile.Buttons[ButtonHome] != 0 {
+		t.Errorf("buttons = %v", profile.Buttons)
+	}
+	if l := profile.Layers[0]; l.Modifier != ButtonLeftBumper || !l.Toggle || !reflect.DeepEqual(l.Invert, []Axis{AxisLeftY}) {
+		t.Errorf("layer = %+v", l)
+	}
+
+	// Errors name the file and the faulty entry
+	os.WriteFile(path, []byte(`{"layers": [{"modifier": "south", "button_axes": {"east": {"axis": "left_trigger", "value": -1}}}]}`), 0o644)
+	if _, err := LoadProfile(path); err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "layer 0: east") {
+		t.Errorf("LoadProfile(invalid) = %v", err)
+	}
+	if _, err := LoadProfile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadProfile of a missing file succeeded")
+	}
+}
+
+func TestProfileValidateErrors(t *testing.T) {
+	for reason, p := range map[string]Profile{
+		"invalid button Button(0x3)":          {Layer: Layer{Buttons: map[Button]Button{ButtonSouth | ButtonEast: ButtonWest}}},
+		"invalid threshold 0 for axis left_x": {Layer: Layer{AxisButtons: []AxisButton{{Axis: AxisLeftX, Button: ButtonSouth}}}},
+		"invalid threshold -0.5":              {Layer: Layer{AxisButtons: []AxisButton{{Axis: AxisLeftTrigger, Threshold: -0.5, Button: ButtonSouth}}}},
+		"invalid axis 6":                      {Layer: Layer{Invert: []Axis{axisCount}}},
+		"modifier must be a single button":    {Layers: []ModifierLayer{{}}},
+	} {
+		if err := p.Validate(); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("Validate(%+v) = %v, want an error about %q", p, err, reason)
+		}
+	}
+}
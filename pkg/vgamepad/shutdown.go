@@ -0,0 +1,129 @@
+package vgamepad
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+var (
+	// Gamepads created by NewBaseGamepad and not closed yet
+	openPads   = make(map[*BaseGamepad]struct{})
+	openPadsMu sync.Mutex
+)
+
+// registerPad records an open gamepad for Shutdown
+func registerPad(g *BaseGamepad) {
+	openPadsMu.Lock()
+	defer openPadsMu.Unlock()
+
+	openPads[g] = struct{}{}
+}
+
+// unregisterPad forgets a closed gamepad
+func unregisterPad(g *BaseGamepad) {
+	openPadsMu.Lock()
+	defer openPadsMu.Unlock()
+
+	delete(openPads, g)
+}
+
+// sendNeutral sends a neutral report for the type of the gamepad (g.mu must be held)
+func (g *BaseGamepad) sendNeutral() error {
+	switch g.client.TargetGetType(g.devicep) {
+	case commons.Xbox360Wired:
+		return g.client.TargetX360Update(g.busp, g.devicep, getDefaultX360Report())
+	case commons.DualShock4Wired:
+		return g.client.TargetDS4Update(g.busp, g.devicep, getDefaultDS4Report())
+	}
+	return nil
+}
+
+// DefaultShutdownTimeout is the timeout used by Shutdown when none is given
+const DefaultShutdownTimeout = 5 * time.Second
+
+// Shutdown sends a neutral report to every gamepad that is still open, closes them and
+// closes the bus, so that no input stays stuck when the program exits. It gives up after
+// timeout (DefaultShutdownTimeout if 0 or less), returning an error, so that a hung driver
+// cannot block the exit. Gamepads cannot be created afterwards.
+func Shutdown(timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		openPadsMu.Lock()
+		pads := make([]*BaseGamepad, 0, len(openPads))
+		for g := range openPads {
+			pads = append(pads, g)
+		}
+		openPadsMu.Unlock()
+
+		for _, g := range pads {
+			g.mu.Lock()
+			if g.devicep != 0 {
+				g.sendNeutral()
+			}
+			g.mu.Unlock()
+			g.Close()
+		}
+
+		shutdownVBus()
+		flushEvents()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("shutdown did not complete within %v", timeout)
+	}
+}
+
+// ShutdownOnSignal calls Shutdown and exits the program with status 1 when one of the
+// signals is received (os.Interrupt and SIGTERM by default). The returned function
+// removes the handler.
+func ShutdownOnSignal(timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ch:
+			Shutdown(timeout)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// ShutdownOnPanic calls Shutdown if the calling goroutine is panicking, then panics again.
+// It must be deferred directly, e.g. at the top of main:
+//
+//	defer vgamepad.ShutdownOnPanic(time.Second)
+func ShutdownOnPanic(timeout time.Duration) {
+	if r := recover(); r != nil {
+		Shutdown(timeout)
+		panic(r)
+	}
+}
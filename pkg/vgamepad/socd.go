@@ -0,0 +1,119 @@
+package vgamepad
+
+import (
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// SOCDMode selects how Simultaneous Opposite Cardinal Directions (SOCD) of the
+// D-pad, e.g. left and right held together, are resolved when the report is sent
+type SOCDMode int
+
+const (
+	SOCDNone           SOCDMode = iota // No cleaning: VX360Gamepad sends both directions, VDS4Gamepad sends neutral
+	SOCDNeutral                        // Opposite directions cancel each other out
+	SOCDLastInputWins                  // The direction pressed last wins
+	SOCDFirstInputWins                 // The direction pressed first wins
+	SOCDUpPriority                     // Up wins over down, left and right cancel each other out
+)
+
+// dpadBits lists the D-pad directions in the order used by BaseGamepad.dpadOrder
+var dpadBits = [4]uint16{
+	uint16(commons.XUSB_GAMEPAD_DPAD_UP),
+	uint16(commons.XUSB_GAMEPAD_DPAD_DOWN),
+	uint16(commons.XUSB_GAMEPAD_DPAD_LEFT),
+	uint16(commons.XUSB_GAMEPAD_DPAD_RIGHT),
+}
+
+// SetSOCDMode selects how opposite D-pad directions held at the same time are resolved
+func (g *BaseGamepad) SetSOCDMode(mode SOCDMode) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.socd = mode
+}
+
+// GetSOCDMode returns how opposite D-pad directions held at the same time are resolved
+func (g *BaseGamepad) GetSOCDMode() SOCDMode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.socd
+}
+
+// noteDPad records the order in which the D-pad directions in held (XUSB_GAMEPAD_DPAD_* bits)
+// were pressed (g.mu must be held)
+func (g *BaseGamepad) noteDPad(held uint16) {
+	for i, bit := range dpadBits {
+		switch {
+		case held&bit == 0:
+			g.dpadOrder[i] = 0
+		case g.dpadHeld&bit == 0:
+			g.dpadSeq++
+			g.dpadOrder[i] = g.dpadSeq
+		}
+	}
+	g.dpadHeld = held & uint16(commons.XUSB_GAMEPAD_DPAD)
+}
+
+// resolveSOCD returns the D-pad directions to send for the held ones (XUSB_GAMEPAD_DPAD_* bits),
+// given their press order (g.mu must be held)
+func (g *BaseGamepad) resolveSOCD(held uint16) uint16 {
+	held = g.resolveSOCDPair(held, 0, 1, g.socd == SOCDUpPriority)
+	return g.resolveSOCDPair(held, 2, 3, false)
+}
+
+// resolveSOCDPair resolves a pair of opposite directions, identified by their index in dpadBits.
+// If firstWins, the first direction of the pair wins regardless of the press order.
+func (g *BaseGamepad) resolveSOCDPair(held uint16, a, b int, firstWins bool) uint16 {
+	bitA, bitB := dpadBits[a], dpadBits[b]
+	if held&bitA == 0 || held&bitB == 0 {
+		return held
+	}
+	switch {
+	case firstWins:
+		return held &^ bitB
+	case g.socd == SOCDNone:
+		return held
+	case g.socd == SOCDLastInputWins && g.dpadOrder[a] > g.dpadOrder[b],
+		g.socd == SOCDFirstInputWins && g.dpadOrder[a] < g.dpadOrder[b]:
+		return held &^ bitB
+	case g.socd == SOCDLastInputWins, g.socd == SOCDFirstInputWins:
+		return held &^ bitA
+	default:
+		return held &^ (bitA | bitB)
+	}
+}
+
+// DirectionalPad sets the direction of the directional pad through the XUSB_GAMEPAD_DPAD_* buttons,
+// like VDS4Gamepad.DirectionalPad
+func (g *VX360Gamepad) DirectionalPad(direction commons.DS4DPadDirection) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: uint16(commons.XUSB_GAMEPAD_DPAD)})
+	g.report.WButtons &^= uint16(commons.XUSB_GAMEPAD_DPAD)
+	g.report.WButtons |= uint16(commons.DS4DPadToXUSB(direction))
+	g.noteDPad(g.report.WButtons)
+}
+
+// PressDirection presses the cardinal directions of the directional pad making up direction
+// (e.g. DS4_BUTTON_DPAD_NORTHEAST presses north and east), keeping the other ones pressed.
+// Opposite directions held together are resolved with the SOCD mode.
+func (g *VDS4Gamepad) PressDirection(direction commons.DS4DPadDirection) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: 0xF})
+	g.dpad |= uint16(commons.DS4DPadToXUSB(direction))
+	g.noteDPad(g.dpad)
+}
+
+// ReleaseDirection releases the cardinal directions of the directional pad making up direction
+func (g *VDS4Gamepad) ReleaseDirection(direction commons.DS4DPadDirection) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: 0xF})
+	g.dpad &^= uint16(commons.DS4DPadToXUSB(direction))
+	g.noteDPad(g.dpad)
+}
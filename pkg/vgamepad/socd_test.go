@@ -0,0 +1,124 @@
+package vgamepad
+
+import (
+	"testing"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+const (
+	dpadUp    = commons.XUSB_GAMEPAD_DPAD_UP
+	dpadDown  = commons.XUSB_GAMEPAD_DPAD_DOWN
+	dpadLeft  = commons.XUSB_GAMEPAD_DPAD_LEFT
+	dpadRight = commons.XUSB_GAMEPAD_DPAD_RIGHT
+)
+
+// sentDPad returns the D-pad directions of the report the gamepad would send
+func sentDPad(g *VX360Gamepad) commons.XUSBButton {
+	return commons.XUSBButton(g.buildReport().WButtons) & commons.XUSB_GAMEPAD_DPAD
+}
+
+func TestSOCDSequences(t *testing.T) {
+	type step struct {
+		press, release commons.XUSBButton
+		want           commons.XUSBButton // Directions sent after the step
+	}
+	tests := []struct {
+		mode  SOCDMode
+		steps []step
+	}{
+		{SOCDNone, []step{
+			{press: dpadLeft, want: dpadLeft},
+			{press: dpadRight, want: dpadLeft | dpadRight},
+		}},
+		{SOCDNeutral, []step{
+			{press: dpadLeft, want: dpadLeft},
+			{press: dpadRight, want: 0},
+			{press: dpadUp, want: dpadUp},
+			{press: dpadDown, want: 0},
+			{release: dpadLeft, want: dpadRight},
+		}},
+		{SOCDLastInputWins, []step{
+			{press: dpadLeft, want: dpadLeft},
+			{press: dpadRight, want: dpadRight},
+			{release: dpadRight, want: dpadLeft},
+			// Pressed again, right is the newest input once more
+			{press: dpadRight, want: dpadRight},
+			{press: dpadDown, want: dpadRight | dpadDown},
+		}},
+		{SOCDFirstInputWins, []step{
+			{press: dpadLeft, want: dpadLeft},
+			{press: dpadRight, want: dpadLeft},
+			{release: dpadLeft, want: dpadRight},
+			{press: dpadLeft, want: dpadRight},
+		}},
+		{SOCDUpPriority, []step{
+			{press: dpadDown, want: dpadDown},
+			{press: dpadUp, want: dpadUp},
+			{release: dpadUp, want: dpadDown},
+			{press: dpadUp | dpadLeft | dpadRight, want: dpadUp},
+		}},
+	}
+	for _, tt := range tests {
+		g := &VX360Gamepad{BaseGamepad: &BaseGamepad{socd: tt.mode}}
+		for i, s := range tt.steps {
+			if s.press != 0 {
+				g.PressButton(s.press)
+			}
+			if s.release != 0 {
+				g.ReleaseButton(s.release)
+			}
+			if got := sentDPad(g); got != s.want {
+				t.Errorf("mode %d, step %d: sent %#x, want %#x", tt.mode, i, got, s.want)
+			}
+		}
+	}
+}
+
+func TestSOCDKeepsTheReport(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	g.SetSOCDMode(SOCDNeutral)
+	g.PressButton(dpadLeft | dpadRight | commons.XUSB_GAMEPAD_A)
+
+	if got := g.buildReport().WButtons; got != uint16(commons.XUSB_GAMEPAD_A) {
+		t.Errorf("sent buttons %#x, want only A", got)
+	}
+	// Cleaning applies to the sent report only: the held directions come back once one is released
+	if got := g.GetReport().WButtons; got != uint16(dpadLeft|dpadRight|commons.XUSB_GAMEPAD_A) {
+		t.Errorf("GetReport() buttons = %#x, want both directions still held", got)
+	}
+	g.ReleaseButton(dpadRight)
+	if got := sentDPad(g); got != dpadLeft {
+		t.Errorf("after releasing right, sent %#x, want left", got)
+	}
+
+	// Replacing the report takes the new directions as pressed now
+	g.SetSOCDMode(SOCDLastInputWins)
+	g.SetReport(commons.XUSBReport{WButtons: uint16(dpadRight)})
+	g.PressButton(dpadLeft)
+	if got := sentDPad(g); got != dpadLeft {
+		t.Errorf("left pressed after SetReport(right) sent %#x, want left", got)
+	}
+}
+
+func TestDS4SOCD(t *testing.T) {
+	g := &VDS4Gamepad{BaseGamepad: &BaseGamepad{}, report: getDefaultDS4Report()}
+	g.PressDirection(commons.DS4_BUTTON_DPAD_WEST)
+	g.PressDirection(commons.DS4_BUTTON_DPAD_EAST)
+
+	// The hat cannot point both ways: without cleaning, it is neutral
+	if got := commons.DS4DPadDirection(g.buildReport().WButtons & 0xF); got != commons.DS4_BUTTON_DPAD_NONE {
+		t.Errorf("west and east without SOCD cleaning = %v, want neutral", got)
+	}
+
+	g.SetSOCDMode(SOCDFirstInputWins)
+	g.PressDirection(commons.DS4_BUTTON_DPAD_NORTH)
+	if got := commons.DS4DPadDirection(g.buildReport().WButtons & 0xF); got != commons.DS4_BUTTON_DPAD_NORTHWEST {
+		t.Errorf("west, east then north, first input wins = %v, want north-west", got)
+	}
+
+	g.ReleaseDirection(commons.DS4_BUTTON_DPAD_NORTHWEST)
+	if got := commons.DS4DPadDirection(g.buildReport().WButtons & 0xF); got != commons.DS4_BUTTON_DPAD_EAST {
+		t.Errorf("after releasing north-west = %v, want east", got)
+	}
+}
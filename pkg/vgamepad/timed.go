@@ -0,0 +1,333 @@
+package vgamepad
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// controlKind identifies the part of a report a control belongs to
+type controlKind int
+
+const (
+	controlButton controlKind = iota
+	controlSpecialButton
+	controlLeftTrigger
+	controlRightTrigger
+	controlLeftJoystick
+	controlRightJoystick
+)
+
+// control identifies a part of the report that a timed action can own.
+// For buttons, mask holds the button bits; it is unused for axes.
+type control struct {
+	kind controlKind
+	mask uint16
+}
+
+// overlaps reports whether two controls share any part of the report
+func (c control) overlaps(o control) bool {
+	if c.kind != o.kind {
+		return false
+	}
+	if c.kind == controlButton || c.kind == controlSpecialButton {
+		return c.mask&o.mask != 0
+	}
+	return true
+}
+
+// ErrActionCancelled is returned by TimedAction.Wait when the action was cancelled, or
+// stopped by a newer input on its control, before it completed
+var ErrActionCancelled = errors.New("the timed action was cancelled before it completed")
+
+// TimedAction is a handle to an input sequence running in the background.
+//
+// A timed action owns the control it drives. Starting another timed action on
+// the same control, or setting that control directly (PressButton, LeftTrigger...),
+// takes ownership away from it: the older action stops and skips its release step,
+// so it can never undo a newer input.
+type TimedAction struct {
+	gamepad *BaseGamepad
+	control control
+	update  func() error
+	cancel  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// Wait blocks until the action has finished. It returns the first update error, or
+// ErrActionCancelled if the action did not complete, or nil if it completed.
+func (a *TimedAction) Wait() error {
+	<-a.done
+	return a.err
+}
+
+// Cancel stops the action early; the control is released if the action still owns it
+func (a *TimedAction) Cancel() {
+	a.once.Do(func() { close(a.cancel) })
+}
+
+// Done returns a channel that is closed when the action has finished
+func (a *TimedAction) Done() <-chan struct{} {
+	return a.done
+}
+
+// cancelled reports whether the action was cancelled, directly or by losing its control
+func (a *TimedAction) cancelled() bool {
+	select {
+	case <-a.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// apply runs f and sends the report while the action still owns its control.
+// It returns false once the action lost its control or the update failed.
+func (a *TimedAction) apply(f func()) bool {
+	g := a.gamepad
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.actions[a]; !ok {
+		return false
+	}
+	f()
+	if err := a.update(); err != nil {
+		a.err = err
+		return false
+	}
+	g.feedWatchdog()
+	return true
+}
+
+// sleep waits for d and returns false if the action was cancelled in the meantime
+func (a *TimedAction) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-a.cancel:
+		return false
+	}
+}
+
+// sleepUntil waits until deadline and returns false if the action was cancelled in the meantime
+func (a *TimedAction) sleepUntil(deadline time.Time) bool {
+	return a.sleep(time.Until(deadline))
+}
+
+// startAction claims c for a new timed action and runs body in the background.
+// update must send the report without locking; release (optional) restores the
+// control once body returns, unless ownership was taken over in the meantime.
+func (g *BaseGamepad) startAction(c control, update func() error, body func(a *TimedAction), release func()) *TimedAction {
+	a := &TimedAction{
+		gamepad: g,
+		control: c,
+		update:  update,
+		cancel:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	g.mu.Lock()
+	g.disown(c)
+	if g.actions == nil {
+		g.actions = make(map[*TimedAction]struct{})
+	}
+	g.actions[a] = struct{}{}
+	g.mu.Unlock()
+
+	go func() {
+		defer close(a.done)
+		body(a)
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if a.err == nil && a.cancelled() {
+			a.err = ErrActionCancelled
+		}
+		if _, ok := g.actions[a]; !ok {
+			return
+		}
+		delete(g.actions, a)
+		if release != nil {
+			release()
+			if err := update(); err != nil {
+				if a.err == nil {
+					a.err = err
+				}
+			} else {
+				g.feedWatchdog()
+			}
+		}
+	}()
+
+	return a
+}
+
+// disown cancels every timed action owning a control that overlaps c (g.mu must be held)
+func (g *BaseGamepad) disown(c control) {
+	for a := range g.actions {
+		if a.control.overlaps(c) {
+			delete(g.actions, a)
+			a.Cancel()
+		}
+	}
+}
+
+// disownAll cancels every timed action of the gamepad (g.mu must be held)
+func (g *BaseGamepad) disownAll() {
+	for a := range g.actions {
+		delete(g.actions, a)
+		a.Cancel()
+	}
+}
+
+// hold sets a control, keeps it for d, then releases it
+func (g *BaseGamepad) hold(c control, update func() error, set, release func(), d time.Duration) *TimedAction {
+	return g.startAction(c, update, func(a *TimedAction) {
+		if a.apply(set) {
+			a.sleep(d)
+		}
+	}, release)
+}
+
+// finishedAction returns a timed action that has already finished, without touching the report
+func (g *BaseGamepad) finishedAction() *TimedAction {
+	a := &TimedAction{gamepad: g, cancel: make(chan struct{}), done: make(chan struct{})}
+	close(a.done)
+	return a
+}
+
+// pulse sets and releases a control count times, spending half of each period in each state.
+// A count of 0 or less does nothing, leaving the control as it is.
+func (g *BaseGamepad) pulse(c control, update func() error, set, release func(), period time.Duration, count int) *TimedAction {
+	if count <= 0 {
+		return g.finishedAction()
+	}
+	return g.startAction(c, update, func(a *TimedAction) {
+		for i := 0; i < count; i++ {
+			if !a.apply(set) || !a.sleep(period/2) {
+				return
+			}
+			if i == count-1 {
+				return
+			}
+			if !a.apply(release) || !a.sleep(period-period/2) {
+				return
+			}
+		}
+	}, release)
+}
+
+// Tap presses a button for d, then releases it, without blocking the caller
+func (g *VX360Gamepad) Tap(button commons.XUSBButton, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlButton, mask: uint16(button)}, g.update,
+		func() { g.report.WButtons |= uint16(button) },
+		func() { g.report.WButtons &^= uint16(button) },
+		d)
+}
+
+// Pulse taps a button count times, one tap per period, without blocking the caller.
+// A count of 0 or less does nothing.
+func (g *VX360Gamepad) Pulse(button commons.XUSBButton, period time.Duration, count int) *TimedAction {
+	return g.pulse(control{kind: controlButton, mask: uint16(button)}, g.update,
+		func() { g.report.WButtons |= uint16(button) },
+		func() { g.report.WButtons &^= uint16(button) },
+		period, count)
+}
+
+// HoldLeftTrigger sets the left trigger (0-255) for d, then releases it, without blocking the caller
+func (g *VX360Gamepad) HoldLeftTrigger(value uint8, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlLeftTrigger}, g.update,
+		func() { g.report.BLeftTrigger = value },
+		func() { g.report.BLeftTrigger = 0 },
+		d)
+}
+
+// HoldRightTrigger sets the right trigger (0-255) for d, then releases it, without blocking the caller
+func (g *VX360Gamepad) HoldRightTrigger(value uint8, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlRightTrigger}, g.update,
+		func() { g.report.BRightTrigger = value },
+		func() { g.report.BRightTrigger = 0 },
+		d)
+}
+
+// HoldLeftJoystick sets the left joystick for d, then returns it to neutral, without blocking the caller
+func (g *VX360Gamepad) HoldLeftJoystick(xValue, yValue int16, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlLeftJoystick}, g.update,
+		func() { g.report.SThumbLX, g.report.SThumbLY = xValue, yValue },
+		func() { g.report.SThumbLX, g.report.SThumbLY = 0, 0 },
+		d)
+}
+
+// HoldRightJoystick sets the right joystick for d, then returns it to neutral, without blocking the caller
+func (g *VX360Gamepad) HoldRightJoystick(xValue, yValue int16, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlRightJoystick}, g.update,
+		func() { g.report.SThumbRX, g.report.SThumbRY = xValue, yValue },
+		func() { g.report.SThumbRX, g.report.SThumbRY = 0, 0 },
+		d)
+}
+
+// Tap presses a button for d, then releases it, without blocking the caller
+func (g *VDS4Gamepad) Tap(button commons.DS4Button, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlButton, mask: uint16(button)}, g.update,
+		func() { g.report.WButtons |= uint16(button) },
+		func() { g.report.WButtons &^= uint16(button) },
+		d)
+}
+
+// TapSpecialButton presses a special button for d, then releases it, without blocking the caller
+func (g *VDS4Gamepad) TapSpecialButton(specialButton commons.DS4SpecialButton, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlSpecialButton, mask: uint16(specialButton)}, g.update,
+		func() { g.report.BSpecial |= uint8(specialButton) },
+		func() { g.report.BSpecial &^= uint8(specialButton) },
+		d)
+}
+
+// Pulse taps a button count times, one tap per period, without blocking the caller.
+// A count of 0 or less does nothing.
+func (g *VDS4Gamepad) Pulse(button commons.DS4Button, period time.Duration, count int) *TimedAction {
+	return g.pulse(control{kind: controlButton, mask: uint16(button)}, g.update,
+		func() { g.report.WButtons |= uint16(button) },
+		func() { g.report.WButtons &^= uint16(button) },
+		period, count)
+}
+
+// HoldLeftTrigger sets the left trigger (0-255) for d, then releases it, without blocking the caller
+func (g *VDS4Gamepad) HoldLeftTrigger(value uint8, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlLeftTrigger}, g.update,
+		func() { g.report.BTriggerL = value },
+		func() { g.report.BTriggerL = 0 },
+		d)
+}
+
+// HoldRightTrigger sets the right trigger (0-255) for d, then releases it, without blocking the caller
+func (g *VDS4Gamepad) HoldRightTrigger(value uint8, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlRightTrigger}, g.update,
+		func() { g.report.BTriggerR = value },
+		func() { g.report.BTriggerR = 0 },
+		d)
+}
+
+// HoldLeftJoystick sets the left joystick for d, then returns it to neutral, without blocking the caller
+func (g *VDS4Gamepad) HoldLeftJoystick(xValue, yValue uint8, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlLeftJoystick}, g.update,
+		func() { g.report.BThumbLX, g.report.BThumbLY = xValue, yValue },
+		func() { g.report.BThumbLX, g.report.BThumbLY = 0x80, 0x80 },
+		d)
+}
+
+// HoldRightJoystick sets the right joystick for d, then returns it to neutral, without blocking the caller
+func (g *VDS4Gamepad) HoldRightJoystick(xValue, yValue uint8, d time.Duration) *TimedAction {
+	return g.hold(control{kind: controlRightJoystick}, g.update,
+		func() { g.report.BThumbRX, g.report.BThumbRY = xValue, yValue },
+		func() { g.report.BThumbRX, g.report.BThumbRY = 0x80, 0x80 },
+		d)
+}
@@ -0,0 +1,227 @@
+package vgamepad
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// MaxTurboRate is the highest turbo rate (Hz) accepted
+const MaxTurboRate = 1000
+
+// Turbo configures autofire for a control: while the control is held,
+// it is toggled on and off Rate times per second
+type Turbo struct {
+	Rate      float64 // Presses per second (Hz, up to MaxTurboRate), 0 disables turbo
+	DutyCycle float64 // Fraction (0.0-1.0) of each period the control stays pressed, 0 means 0.5
+}
+
+// turboState is the runtime state of a control with turbo enabled
+type turboState struct {
+	turbo Turbo
+	since time.Time // When the control started being held, zero while released
+}
+
+// period returns the duration of one press/release cycle
+func (t *turboState) period() time.Duration {
+	return time.Duration(float64(time.Second) / t.turbo.Rate)
+}
+
+// onTime returns how long the control stays pressed within a period
+func (t *turboState) onTime() time.Duration {
+	duty := t.turbo.DutyCycle
+	if duty == 0 {
+		duty = 0.5
+	}
+	return time.Duration(float64(t.period()) * duty)
+}
+
+// active reports whether a control that is held (or not) is in the pressed part of its turbo cycle
+func (t *turboState) active(held bool, now time.Time) bool {
+	if !held {
+		t.since = time.Time{}
+		return false
+	}
+	if t.since.IsZero() {
+		t.since = now
+	}
+	return now.Sub(t.since)%t.period() < t.onTime()
+}
+
+// nextEdge returns when the held control toggles next, or false if it is released
+func (t *turboState) nextEdge(now time.Time) (time.Time, bool) {
+	if t.since.IsZero() {
+		return time.Time{}, false
+	}
+	period := t.period()
+	cycle := t.since.Add(now.Sub(t.since) / period * period)
+	if off := cycle.Add(t.onTime()); now.Before(off) {
+		return off, true
+	}
+	return cycle.Add(period), true
+}
+
+// Validate returns an error if the turbo settings are not usable
+func (t Turbo) Validate() error {
+	if t.Rate < 0 || t.Rate > MaxTurboRate || math.IsNaN(t.Rate) {
+		return fmt.Errorf("invalid turbo rate %v, must be between 0 and %v Hz", t.Rate, MaxTurboRate)
+	}
+	if t.DutyCycle < 0 || t.DutyCycle > 1 || math.IsNaN(t.DutyCycle) {
+		return fmt.Errorf("invalid turbo duty cycle %v, must be between 0.0 and 1.0", t.DutyCycle)
+	}
+	return nil
+}
+
+// setTurbo enables (or disables, if turbo.Rate is 0) turbo on c and makes sure
+// the refresh loop runs to send the toggles
+func (g *BaseGamepad) setTurbo(c control, turbo Turbo, update func() error) error {
+	if err := turbo.Validate(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if turbo.Rate == 0 {
+		delete(g.turbos, c)
+		return nil
+	}
+	if g.turbos == nil {
+		g.turbos = make(map[control]*turboState)
+	}
+	g.turbos[c] = &turboState{turbo: turbo}
+	g.startRefresh(update)
+	return nil
+}
+
+// startRefresh starts the refresh loop if it is not running (g.mu must be held)
+func (g *BaseGamepad) startRefresh(update func() error) {
+	if g.refreshWake == nil {
+		g.refreshWake = make(chan struct{}, 1)
+		go g.refreshLoop(update)
+	}
+}
+
+// wakeRefresh tells the refresh loop that the report changed (g.mu must be held)
+func (g *BaseGamepad) wakeRefresh() {
+	if g.refreshWake == nil {
+		return
+	}
+	select {
+	case g.refreshWake <- struct{}{}:
+	default:
+	}
+}
+
+// refreshLoop sends a report on every turbo toggle of the held controls and while humanization
+// filters are moving, until both are disabled or the gamepad is closed
+func (g *BaseGamepad) refreshLoop(update func() error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		g.mu.Lock()
+		if g.devicep == 0 || (len(g.turbos) == 0 && g.humanizer == nil) {
+			g.refreshWake = nil
+			g.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		var next time.Time
+		for _, t := range g.turbos {
+			if edge, ok := t.nextEdge(now); ok && (next.IsZero() || edge.Before(next)) {
+				next = edge
+			}
+		}
+		if g.humanizer != nil {
+			if edge, ok := g.humanizer.next(now, g.updateRate()); ok && (next.IsZero() || edge.Before(next)) {
+				next = edge
+			}
+		}
+		wake := g.refreshWake
+		g.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next.IsZero() {
+			<-wake
+			continue
+		}
+		timer.Reset(time.Until(next))
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			g.mu.Lock()
+			if g.devicep != 0 {
+				update()
+			}
+			g.mu.Unlock()
+		}
+	}
+}
+
+// applyButtonTurbo releases the buttons of report that are in the released part of their turbo cycle.
+// A turbo on a combination only toggles it while every button of the combination is held.
+func applyButtonTurbo(turbos map[control]*turboState, kind controlKind, buttons uint16, now time.Time) uint16 {
+	for c, t := range turbos {
+		if c.kind != kind {
+			continue
+		}
+		if held := buttons&c.mask == c.mask; !t.active(held, now) && held {
+			buttons &^= c.mask
+		}
+	}
+	return buttons
+}
+
+// applyTriggerTurbo returns 0 if the trigger is in the released part of its turbo cycle, value otherwise
+func applyTriggerTurbo(turbos map[control]*turboState, kind controlKind, value uint8, now time.Time) uint8 {
+	if t, ok := turbos[control{kind: kind}]; ok && !t.active(value > 0, now) {
+		return 0
+	}
+	return value
+}
+
+// SetTurbo enables autofire on a button (turbo.Rate = 0 disables it)
+func (g *VX360Gamepad) SetTurbo(button commons.XUSBButton, turbo Turbo) error {
+	return g.setTurbo(control{kind: controlButton, mask: uint16(button)}, turbo, g.update)
+}
+
+// SetLeftTriggerTurbo enables autofire on the left trigger, treated as a digital button (turbo.Rate = 0 disables it)
+func (g *VX360Gamepad) SetLeftTriggerTurbo(turbo Turbo) error {
+	return g.setTurbo(control{kind: controlLeftTrigger}, turbo, g.update)
+}
+
+// SetRightTriggerTurbo enables autofire on the right trigger, treated as a digital button (turbo.Rate = 0 disables it)
+func (g *VX360Gamepad) SetRightTriggerTurbo(turbo Turbo) error {
+	return g.setTurbo(control{kind: controlRightTrigger}, turbo, g.update)
+}
+
+// SetTurbo enables autofire on a button (turbo.Rate = 0 disables it)
+func (g *VDS4Gamepad) SetTurbo(button commons.DS4Button, turbo Turbo) error {
+	return g.setTurbo(control{kind: controlButton, mask: uint16(button)}, turbo, g.update)
+}
+
+// SetSpecialTurbo enables autofire on a special button (turbo.Rate = 0 disables it)
+func (g *VDS4Gamepad) SetSpecialTurbo(specialButton commons.DS4SpecialButton, turbo Turbo) error {
+	return g.setTurbo(control{kind: controlSpecialButton, mask: uint16(specialButton)}, turbo, g.update)
+}
+
+// SetLeftTriggerTurbo enables autofire on the left trigger, treated as a digital button (turbo.Rate = 0 disables it).
+// The DS4_BUTTON_TRIGGER_LEFT bit follows the trigger.
+func (g *VDS4Gamepad) SetLeftTriggerTurbo(turbo Turbo) error {
+	return g.setTurbo(control{kind: controlLeftTrigger}, turbo, g.update)
+}
+
+// SetRightTriggerTurbo enables autofire on the right trigger, treated as a digital button (turbo.Rate = 0 disables it).
+// The DS4_BUTTON_TRIGGER_RIGHT bit follows the trigger.
+func (g *VDS4Gamepad) SetRightTriggerTurbo(turbo Turbo) error {
+	return g.setTurbo(control{kind: controlRightTrigger}, turbo, g.update)
+}
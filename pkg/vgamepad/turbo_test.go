@@ -0,0 +1,204 @@
+package vgamepad
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/CB2Moon/vgamepad-go/pkg/commons"
+)
+
+// epoch is an arbitrary start time for tests driving the clock by hand
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns epoch plus ms milliseconds
+func at(ms int) time.Time {
+	return epoch.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func TestTurboDutyCycle(t *testing.T) {
+	// 10 Hz with a 30% duty cycle: pressed for the first 30ms of every 100ms
+	s := &turboState{turbo: Turbo{Rate: 10, DutyCycle: 0.3}}
+
+	steps := []struct {
+		ms     int
+		held   bool
+		active bool
+	}{
+		{0, true, true},
+		{29, true, true},
+		{30, true, false},
+		{99, true, false},
+		{100, true, true},
+		{135, true, false},
+		{150, false, false},
+		// Pressed again in what would have been the released part: a new cycle starts at once
+		{160, true, true},
+		{189, true, true},
+		{190, true, false},
+	}
+	for _, step := range steps {
+		if got := s.active(step.held, at(step.ms)); got != step.active {
+			t.Errorf("at %dms (held: %v), active = %v, want %v", step.ms, step.held, got, step.active)
+		}
+	}
+}
+
+func TestTurboDefaultDutyCycle(t *testing.T) {
+	s := &turboState{turbo: Turbo{Rate: 4}}
+	if s.period() != 250*time.Millisecond || s.onTime() != 125*time.Millisecond {
+		t.Errorf("period = %v, on time = %v, want 250ms and 125ms", s.period(), s.onTime())
+	}
+
+	full := &turboState{turbo: Turbo{Rate: MaxTurboRate, DutyCycle: 1}}
+	for us := 0; us < 5000; us += 125 {
+		if !full.active(true, epoch.Add(time.Duration(us)*time.Microsecond)) {
+			t.Fatalf("a 100%% duty cycle released the control after %dµs", us)
+		}
+	}
+}
+
+func TestTurboNextEdge(t *testing.T) {
+	s := &turboState{turbo: Turbo{Rate: 10, DutyCycle: 0.3}}
+	if _, ok := s.nextEdge(epoch); ok {
+		t.Fatal("nextEdge reported an edge for a control that was never held")
+	}
+
+	s.active(true, epoch)
+	edges := []struct{ now, want int }{
+		{0, 30},
+		{10, 30},
+		{30, 100},
+		{99, 100},
+		{100, 130},
+		{250, 300},
+	}
+	for _, e := range edges {
+		if got, ok := s.nextEdge(at(e.now)); !ok || !got.Equal(at(e.want)) {
+			t.Errorf("nextEdge at %dms = %v, want %dms", e.now, got.Sub(epoch), e.want)
+		}
+	}
+
+	// Every edge flips the state of the control
+	now, want := epoch, true
+	for i := 0; i < 20; i++ {
+		if got := s.active(true, now); got != want {
+			t.Fatalf("at edge %d (%v), active = %v, want %v", i, now.Sub(epoch), got, want)
+		}
+		now, _ = s.nextEdge(now)
+		want = !want
+	}
+
+	s.active(false, now)
+	if _, ok := s.nextEdge(now); ok {
+		t.Error("nextEdge reported an edge after the control was released")
+	}
+}
+
+func TestTurboCombination(t *testing.T) {
+	a, b := uint16(commons.XUSB_GAMEPAD_A), uint16(commons.XUSB_GAMEPAD_B)
+	turbos := map[control]*turboState{
+		{kind: controlButton, mask: a | b}: {turbo: Turbo{Rate: 10}},
+	}
+
+	// A alone is not the combination and must not be released by its turbo
+	if got := applyButtonTurbo(turbos, controlButton, a, at(60)); got != a {
+		t.Errorf("A alone = %#x, want %#x", got, a)
+	}
+
+	if got := applyButtonTurbo(turbos, controlButton, a|b, at(0)); got != a|b {
+		t.Errorf("A+B at the start of the cycle = %#x, want %#x", got, a|b)
+	}
+	if got := applyButtonTurbo(turbos, controlButton, a|b|uint16(commons.XUSB_GAMEPAD_X), at(60)); got != uint16(commons.XUSB_GAMEPAD_X) {
+		t.Errorf("A+B+X in the released part = %#x, want only X", got)
+	}
+	// Special buttons share the bits but not the turbo, and do not restart its cycle
+	if got := applyButtonTurbo(turbos, controlSpecialButton, a, at(70)); got != a {
+		t.Errorf("special button = %#x, want %#x", got, a)
+	}
+	if got := applyButtonTurbo(turbos, controlButton, a|b, at(80)); got != 0 {
+		t.Errorf("A+B at 80ms = %#x, want released", got)
+	}
+}
+
+func TestDS4TriggerTurbo(t *testing.T) {
+	bit := commons.DS4_BUTTON_TRIGGER_LEFT
+	turbos := map[control]*turboState{{kind: controlLeftTrigger}: {turbo: Turbo{Rate: 10}}}
+
+	// The digital bit alone holds the trigger
+	value, buttons := applyDS4TriggerTurbo(turbos, controlLeftTrigger, 0, uint16(bit), bit, at(0))
+	if value != 0 || buttons != uint16(bit) {
+		t.Errorf("bit only, pressed part = %d, %#x, want 0, %#x", value, buttons, bit)
+	}
+	value, buttons = applyDS4TriggerTurbo(turbos, controlLeftTrigger, 180, uint16(bit|commons.DS4_BUTTON_CROSS), bit, at(60))
+	if value != 0 || buttons != uint16(commons.DS4_BUTTON_CROSS) {
+		t.Errorf("released part = %d, %#x, want the trigger and its bit released", value, buttons)
+	}
+	// No turbo on the right trigger
+	if value, _ := applyDS4TriggerTurbo(turbos, controlRightTrigger, 180, 0, commons.DS4_BUTTON_TRIGGER_RIGHT, at(60)); value != 180 {
+		t.Errorf("right trigger = %d, want 180", value)
+	}
+}
+
+func TestX360TurboReport(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{}}
+	if err := g.SetTurbo(commons.XUSB_GAMEPAD_A, Turbo{Rate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetLeftTriggerTurbo(Turbo{Rate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetRightTriggerTurbo(Turbo{Rate: -1}); err == nil {
+		t.Error("SetRightTriggerTurbo accepted a negative rate")
+	}
+	if len(g.turbos) != 2 {
+		t.Fatalf("%d turbos set, want 2", len(g.turbos))
+	}
+
+	g.PressButton(commons.XUSB_GAMEPAD_A | commons.XUSB_GAMEPAD_B)
+	g.LeftTrigger(200)
+	report := g.buildReport()
+	if report.WButtons != uint16(commons.XUSB_GAMEPAD_A|commons.XUSB_GAMEPAD_B) || report.BLeftTrigger != 200 {
+		t.Errorf("first report = %#x, %d, want A+B and 200", report.WButtons, report.BLeftTrigger)
+	}
+
+	// Move the start of the cycles back into their released half (500ms to 1s)
+	for _, s := range g.turbos {
+		s.since = time.Now().Add(-750 * time.Millisecond)
+	}
+	report = g.buildReport()
+	if report.WButtons != uint16(commons.XUSB_GAMEPAD_B) || report.BLeftTrigger != 0 {
+		t.Errorf("report in the released part = %#x, %d, want B and 0", report.WButtons, report.BLeftTrigger)
+	}
+	if g.GetReport().WButtons != uint16(commons.XUSB_GAMEPAD_A|commons.XUSB_GAMEPAD_B) {
+		t.Error("turbo changed the report returned by GetReport")
+	}
+
+	if err := g.SetTurbo(commons.XUSB_GAMEPAD_A, Turbo{}); err != nil || len(g.turbos) != 1 {
+		t.Errorf("SetTurbo with a rate of 0 = %v, %d turbos left, want 1", err, len(g.turbos))
+	}
+}
+
+func TestTurboValidate(t *testing.T) {
+	valid := []Turbo{{}, {Rate: MaxTurboRate}, {Rate: 0.5, DutyCycle: 1}}
+	for _, turbo := range valid {
+		if err := turbo.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v, want nil", turbo, err)
+		}
+	}
+
+	invalid := []Turbo{
+		{Rate: -1},
+		{Rate: MaxTurboRate + 0.1},
+		{Rate: math.Inf(1)},
+		{Rate: math.NaN()},
+		{Rate: 10, DutyCycle: -0.1},
+		{Rate: 10, DutyCycle: 1.1},
+		{Rate: 10, DutyCycle: math.NaN()},
+	}
+	for _, turbo := range invalid {
+		if err := turbo.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", turbo)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package vgamepad
+
+import (
+	"math"
+	"time"
+)
+
+// Easing maps the progress t of a tween (0.0-1.0) to the fraction of the distance covered (0.0 at t = 0, 1.0 at t = 1).
+// Any function with this signature can be used as a custom easing.
+type Easing func(t float64) float64
+
+// Linear moves at constant speed
+func Linear(t float64) float64 {
+	return t
+}
+
+// EaseIn starts slowly and accelerates (quadratic)
+func EaseIn(t float64) float64 {
+	return t * t
+}
+
+// EaseOut starts fast and decelerates (quadratic)
+func EaseOut(t float64) float64 {
+	return t * (2 - t)
+}
+
+// EaseInOut accelerates then decelerates (cubic)
+func EaseInOut(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	return 1 - math.Pow(-2*t+2, 3)/2
+}
+
+// animate calls step with the progress (0.0-1.0) of a motion lasting d, at the update
+// rate of the gamepad, and sends a report after each step. The last step always has
+// progress 1.0, unless the motion is cancelled; the control is not released afterwards.
+func (g *BaseGamepad) animate(c control, update func() error, d time.Duration, step func(progress float64)) *TimedAction {
+	g.mu.Lock()
+	interval := time.Duration(float64(time.Second) / g.updateRate())
+	g.mu.Unlock()
+
+	return g.startAction(c, update, func(a *TimedAction) {
+		begin := time.Now()
+		end := begin.Add(d)
+
+		for frame := 1; ; frame++ {
+			deadline := begin.Add(time.Duration(frame) * interval)
+			if deadline.After(end) {
+				deadline = end
+			}
+			if !a.sleepUntil(deadline) {
+				return
+			}
+
+			progress := 1.0
+			if d > 0 {
+				progress = math.Min(float64(deadline.Sub(begin))/float64(d), 1)
+			}
+			if !a.apply(func() { step(progress) }) || progress >= 1 {
+				return
+			}
+		}
+	}, nil)
+}
+
+// tween moves the axes read by from to the values to over d, calling set with the
+// intermediate values. A nil easing means Linear.
+func (g *BaseGamepad) tween(c control, update func() error, from func() []float64, to []float64, d time.Duration, easing Easing, set func(values []float64)) *TimedAction {
+	if easing == nil {
+		easing = Linear
+	}
+
+	var start []float64
+	values := make([]float64, len(to))
+	return g.animate(c, update, d, func(progress float64) {
+		if start == nil {
+			start = from()
+		}
+		k := easing(progress)
+		for i := range to {
+			// Weighted so that the last step lands exactly on to
+			values[i] = start[i]*(1-k) + to[i]*k
+		}
+		set(values)
+	})
+}
+
+// MoveLeftJoystickTo moves the left joystick to (x, y) (-1.0 to 1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curves and processing as LeftJoystickFloat.
+func (g *VX360Gamepad) MoveLeftJoystickTo(xValueFloat, yValueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlLeftJoystick}, g.update,
+		func() []float64 {
+			x, y := g.leftStick.source(x360AxisToFloat(g.report.SThumbLX), x360AxisToFloat(g.report.SThumbLY))
+			return []float64{x, y}
+		},
+		[]float64{xValueFloat, yValueFloat}, d, easing,
+		func(v []float64) { g.leftJoystickFloat(v[0], v[1]) })
+}
+
+// MoveRightJoystickTo moves the right joystick to (x, y) (-1.0 to 1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curves and processing as RightJoystickFloat.
+func (g *VX360Gamepad) MoveRightJoystickTo(xValueFloat, yValueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlRightJoystick}, g.update,
+		func() []float64 {
+			x, y := g.rightStick.source(x360AxisToFloat(g.report.SThumbRX), x360AxisToFloat(g.report.SThumbRY))
+			return []float64{x, y}
+		},
+		[]float64{xValueFloat, yValueFloat}, d, easing,
+		func(v []float64) { g.rightJoystickFloat(v[0], v[1]) })
+}
+
+// RampLeftTrigger moves the left trigger to value (0.0-1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curve and processing as LeftTriggerFloat.
+func (g *VX360Gamepad) RampLeftTrigger(valueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlLeftTrigger}, g.update,
+		func() []float64 { return []float64{g.leftTrigger.source(triggerToFloat(g.report.BLeftTrigger))} },
+		[]float64{valueFloat}, d, easing,
+		func(v []float64) { g.leftTriggerFloat(v[0]) })
+}
+
+// RampRightTrigger moves the right trigger to value (0.0-1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curve and processing as RightTriggerFloat.
+func (g *VX360Gamepad) RampRightTrigger(valueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlRightTrigger}, g.update,
+		func() []float64 { return []float64{g.rightTrigger.source(triggerToFloat(g.report.BRightTrigger))} },
+		[]float64{valueFloat}, d, easing,
+		func(v []float64) { g.rightTriggerFloat(v[0]) })
+}
+
+// MoveLeftJoystickTo moves the left joystick to (x, y) (-1.0 to 1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curves and processing as LeftJoystickFloat.
+func (g *VDS4Gamepad) MoveLeftJoystickTo(xValueFloat, yValueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlLeftJoystick}, g.update,
+		func() []float64 {
+			x, y := g.leftStick.source(ds4AxisToFloat(g.report.BThumbLX), g.yAxisToFloat(g.report.BThumbLY))
+			return []float64{x, y}
+		},
+		[]float64{xValueFloat, yValueFloat}, d, easing,
+		func(v []float64) { g.leftJoystickFloat(v[0], v[1]) })
+}
+
+// MoveRightJoystickTo moves the right joystick to (x, y) (-1.0 to 1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curves and processing as RightJoystickFloat.
+func (g *VDS4Gamepad) MoveRightJoystickTo(xValueFloat, yValueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlRightJoystick}, g.update,
+		func() []float64 {
+			x, y := g.rightStick.source(ds4AxisToFloat(g.report.BThumbRX), g.yAxisToFloat(g.report.BThumbRY))
+			return []float64{x, y}
+		},
+		[]float64{xValueFloat, yValueFloat}, d, easing,
+		func(v []float64) { g.rightJoystickFloat(v[0], v[1]) })
+}
+
+// RampLeftTrigger moves the left trigger to value (0.0-1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curve and processing as LeftTriggerFloat.
+func (g *VDS4Gamepad) RampLeftTrigger(valueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlLeftTrigger}, g.update,
+		func() []float64 { return []float64{g.leftTrigger.source(triggerToFloat(g.report.BTriggerL))} },
+		[]float64{valueFloat}, d, easing,
+		func(v []float64) { g.leftTriggerFloat(v[0]) })
+}
+
+// RampRightTrigger moves the right trigger to value (0.0-1.0) over d, sending intermediate reports at the update rate.
+// The intermediate values go through the same curve and processing as RightTriggerFloat.
+func (g *VDS4Gamepad) RampRightTrigger(valueFloat float64, d time.Duration, easing Easing) *TimedAction {
+	return g.tween(control{kind: controlRightTrigger}, g.update,
+		func() []float64 { return []float64{g.rightTrigger.source(triggerToFloat(g.report.BTriggerR))} },
+		[]float64{valueFloat}, d, easing,
+		func(v []float64) { g.rightTriggerFloat(v[0]) })
+}
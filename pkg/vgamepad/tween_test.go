@@ -0,0 +1,251 @@
+package vgamepad
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEasing(t *testing.T) {
+	easings := []struct {
+		name   string
+		easing Easing
+	}{
+		{"Linear", Linear},
+		{"EaseIn", EaseIn},
+		{"EaseOut", EaseOut},
+		{"EaseInOut", EaseInOut},
+	}
+	for _, e := range easings {
+		if start, end := e.easing(0), e.easing(1); start != 0 || end != 1 {
+			t.Errorf("%s(0), %s(1) = %v, %v, want 0, 1", e.name, e.name, start, end)
+		}
+		previous := 0.0
+		for i := 1; i <= 100; i++ {
+			v := e.easing(float64(i) / 100)
+			if v < previous {
+				t.Errorf("%s goes back at %v: %v after %v", e.name, float64(i)/100, v, previous)
+				break
+			}
+			previous = v
+		}
+	}
+
+	if v := EaseInOut(0.5); v != 0.5 {
+		t.Errorf("EaseInOut(0.5) = %v, want 0.5", v)
+	}
+	// EaseIn lags behind Linear, EaseOut is ahead of it, and each mirrors the other
+	for _, x := range []float64{0.1, 0.25, 0.7} {
+		if EaseIn(x) >= x || EaseOut(x) <= x {
+			t.Errorf("EaseIn(%v) = %v, EaseOut(%v) = %v, want below and above %v", x, EaseIn(x), x, EaseOut(x), x)
+		}
+		if s := EaseIn(x) + EaseOut(1-x); math.Abs(s-1) > 1e-12 {
+			t.Errorf("EaseIn(%v) + EaseOut(%v) = %v, want 1", x, 1-x, s)
+		}
+	}
+}
+
+func TestAnimateFrames(t *testing.T) {
+	g := &BaseGamepad{rate: 500}
+	var progress []float64
+	sent := 0
+	a := g.animate(control{kind: controlLeftTrigger}, func() error { sent++; return nil }, 40*time.Millisecond,
+		func(p float64) { progress = append(progress, p) })
+	if err := a.Wait(); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+
+	// Frames are scheduled from the start, so 40ms at 500 Hz is always 20 frames, even on a slow machine
+	if len(progress) != 20 || sent != 20 {
+		t.Fatalf("%d steps and %d reports, want 20", len(progress), sent)
+	}
+	for i, p := range progress {
+		if want := float64(i+1) / 20; math.Abs(p-want) > 1e-9 {
+			t.Errorf("step %d progress = %v, want %v", i, p, want)
+		}
+	}
+	if progress[19] != 1 {
+		t.Errorf("last progress = %v, want exactly 1", progress[19])
+	}
+
+	// No duration: a single step to the end
+	progress = nil
+	if err := g.animate(control{kind: controlLeftTrigger}, func() error { return nil }, 0,
+		func(p float64) { progress = append(progress, p) }).Wait(); err != nil || len(progress) != 1 || progress[0] != 1 {
+		t.Errorf("animation of 0s: progress %v, err %v, want [1] and nil", progress, err)
+	}
+}
+
+func TestAnimateUpdateError(t *testing.T) {
+	g := &BaseGamepad{rate: 1000}
+	failure := errors.New("device gone")
+	sent := 0
+	a := g.animate(control{kind: controlLeftJoystick}, func() error {
+		sent++
+		if sent == 3 {
+			return failure
+		}
+		return nil
+	}, 50*time.Millisecond, func(float64) {})
+
+	if err := a.Wait(); err != failure {
+		t.Errorf("Wait() = %v, want the update error", err)
+	}
+	if sent != 3 {
+		t.Errorf("%d reports sent, want the animation to stop after the failed one", sent)
+	}
+}
+
+func TestTweenStartsWhereTheControlIs(t *testing.T) {
+	g := &BaseGamepad{rate: 10}
+	current := 0.0
+	var values []float64
+	a := g.tween(control{kind: controlRightTrigger}, func() error { return nil },
+		func() []float64 { return []float64{current} },
+		[]float64{0.2}, 300*time.Millisecond, EaseOut,
+		func(v []float64) { values = append(values, v[0]) })
+	// Read at the first frame (100ms), not when the tween is created
+	g.mu.Lock()
+	current = 1
+	g.mu.Unlock()
+
+	if err := a.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range values {
+		if v > 1 || v < 0.2 || (i > 0 && v > values[i-1]) {
+			t.Fatalf("values %v do not go down from 1 to 0.2", values)
+		}
+	}
+	if values[len(values)-1] != 0.2 {
+		t.Errorf("last value = %v, want 0.2", values[len(values)-1])
+	}
+}
+
+func TestPipelineSource(t *testing.T) {
+	p := &stickPipeline{processing: StickProcessing{Deadzone: 0.2}}
+	if x, y := p.apply(0.1, 0.05); x != 0 || y != 0 {
+		t.Fatalf("apply(0.1, 0.05) = %v, %v, want the deadzone to hold it at 0, 0", x, y)
+	}
+	if x, y := p.source(0, 0); x != 0.1 || y != 0.05 {
+		t.Errorf("source(0, 0) = %v, %v, want the last input 0.1, 0.05", x, y)
+	}
+	// Anything else was not written by the pipeline, e.g. a raw setter, and is its own source
+	if x, y := p.source(0.5, 0); x != 0.5 || y != 0 {
+		t.Errorf("source(0.5, 0) = %v, %v, want 0.5, 0", x, y)
+	}
+
+	tp := &triggerPipeline{processing: TriggerProcessing{Deadzone: 0.5}}
+	out := tp.apply(0.8)
+	if v := tp.source(triggerToFloat(triggerFromFloat(out))); v != 0.8 {
+		t.Errorf("source of the trigger read back from the report = %v, want 0.8", v)
+	}
+}
+
+func TestRampThroughPipeline(t *testing.T) {
+	g := &VX360Gamepad{BaseGamepad: &BaseGamepad{rate: 1000}}
+	g.SetLeftTriggerProcessing(TriggerProcessing{Deadzone: 0.5})
+	g.LeftTriggerFloat(0.8)
+	start := g.report.BLeftTrigger
+
+	// The wiring of RampLeftTrigger, with a fake update recording the reports
+	var sent []uint8
+	a := g.tween(control{kind: controlLeftTrigger}, func() error {
+		sent = append(sent, g.report.BLeftTrigger)
+		return nil
+	}, func() []float64 { return []float64{g.leftTrigger.source(triggerToFloat(g.report.BLeftTrigger))} },
+		[]float64{1}, 20*time.Millisecond, nil,
+		func(v []float64) { g.leftTriggerFloat(v[0]) })
+	if err := a.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Starting from the processed value (0.6) instead of the input (0.8) would drop the trigger
+	// through the deadzone on the first frame
+	previous := start
+	for i, v := range sent {
+		if v < previous {
+			t.Fatalf("report %d went back from %d to %d (reports %v)", i, previous, v, sent)
+		}
+		previous = v
+	}
+	if previous != 255 {
+		t.Errorf("last report = %d, want 255", previous)
+	}
+}
+
+func TestTimedActionOwnership(t *testing.T) {
+	g := &BaseGamepad{rate: 1000}
+	update := func() error { return nil }
+	var buttons uint16
+	releases := map[string]int{}
+	hold := func(name string, mask uint16, d time.Duration) *TimedAction {
+		return g.hold(control{kind: controlButton, mask: mask}, update,
+			func() { buttons |= mask },
+			func() { buttons &^= mask; releases[name]++ },
+			d)
+	}
+
+	a := hold("a", 0x1, time.Hour)
+	if err := hold("b", 0x2, 5*time.Millisecond).Wait(); err != nil {
+		t.Fatalf("an action on another button failed: %v", err)
+	}
+	select {
+	case <-a.Done():
+		t.Fatal("an action on another button stopped the first one")
+	default:
+	}
+
+	// 0x1|0x4 overlaps a: it takes the button over, and a must not release it
+	c := hold("c", 0x1|0x4, time.Hour)
+	if err := a.Wait(); !errors.Is(err, ErrActionCancelled) {
+		t.Errorf("Wait() of the replaced action = %v, want ErrActionCancelled", err)
+	}
+
+	// Setting the control directly takes it over too
+	x := &VX360Gamepad{BaseGamepad: g}
+	x.PressButton(0x4)
+	if err := c.Wait(); !errors.Is(err, ErrActionCancelled) {
+		t.Errorf("Wait() after PressButton = %v, want ErrActionCancelled", err)
+	}
+
+	// An action that still owns its control releases it when cancelled
+	d := hold("d", 0x8, time.Hour)
+	d.Cancel()
+	if err := d.Wait(); !errors.Is(err, ErrActionCancelled) {
+		t.Errorf("Wait() after Cancel = %v, want ErrActionCancelled", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if releases["a"] != 0 || releases["c"] != 0 {
+		t.Errorf("replaced actions released their buttons (%v)", releases)
+	}
+	if releases["b"] != 1 || releases["d"] != 1 || buttons&0x8 != 0 {
+		t.Errorf("releases = %v, buttons = %#x, want b and d released once", releases, buttons)
+	}
+	if len(g.actions) != 0 {
+		t.Errorf("%d actions still registered", len(g.actions))
+	}
+}
+
+func TestPulseCount(t *testing.T) {
+	g := &BaseGamepad{rate: 1000}
+	var presses int
+	set := func() { presses++ }
+
+	if err := g.pulse(control{kind: controlButton, mask: 1}, func() error { return nil }, set, func() {}, time.Millisecond, 0).Wait(); err != nil {
+		t.Errorf("Wait() of an empty pulse = %v", err)
+	}
+	if presses != 0 {
+		t.Errorf("an empty pulse pressed the button %d times", presses)
+	}
+
+	if err := g.pulse(control{kind: controlButton, mask: 1}, func() error { return nil }, set, func() {}, 2*time.Millisecond, 3).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if presses != 3 {
+		t.Errorf("the button was pressed %d times, want 3", presses)
+	}
+}
@@ -0,0 +1,101 @@
+package vgamepad
+
+import (
+	"time"
+)
+
+// watchdog is the runtime state of the watchdog of a gamepad
+type watchdog struct {
+	timeout    time.Duration
+	onTimeout  func()
+	neutralize func() error // Resets the gamepad and sends the report (g.mu must be held)
+	last       time.Time    // When Update was last called
+	timer      *time.Timer  // Checks for the timeout, nil once the watchdog fired until the next Update
+}
+
+// setWatchdog enables (or disables, if timeout is 0) the watchdog
+func (g *BaseGamepad) setWatchdog(timeout time.Duration, onTimeout func(), neutralize func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopWatchdog()
+	if timeout <= 0 {
+		return
+	}
+	g.watchdog = &watchdog{timeout: timeout, onTimeout: onTimeout, neutralize: neutralize, last: time.Now()}
+	g.armWatchdog(g.watchdog, timeout)
+}
+
+// stopWatchdog disables the watchdog (g.mu must be held)
+func (g *BaseGamepad) stopWatchdog() {
+	if g.watchdog != nil && g.watchdog.timer != nil {
+		g.watchdog.timer.Stop()
+	}
+	g.watchdog = nil
+}
+
+// feedWatchdog records a call to Update, or a report sent by a timed action, and arms the watchdog again if it fired (g.mu must be held)
+func (g *BaseGamepad) feedWatchdog() {
+	w := g.watchdog
+	if w == nil {
+		return
+	}
+	w.last = time.Now()
+	if w.timer == nil {
+		g.armWatchdog(w, w.timeout)
+	}
+}
+
+// armWatchdog checks the watchdog for a timeout after d (g.mu must be held)
+func (g *BaseGamepad) armWatchdog(w *watchdog, d time.Duration) {
+	w.timer = time.AfterFunc(d, func() {
+		g.mu.Lock()
+		if g.watchdog != w || g.devicep == 0 {
+			g.mu.Unlock()
+			return
+		}
+		if len(g.actions) > 0 {
+			// A timed action drives the gamepad, even while it holds a control without sending anything
+			g.armWatchdog(w, w.timeout)
+			g.mu.Unlock()
+			return
+		}
+		if elapsed := time.Since(w.last); elapsed < w.timeout {
+			g.armWatchdog(w, w.timeout-elapsed)
+			g.mu.Unlock()
+			return
+		}
+		w.timer = nil
+		if err := w.neutralize(); err != nil {
+			g.publish(EventUpdateError, err)
+		}
+		g.publish(EventWatchdogTimeout, nil)
+		g.mu.Unlock()
+
+		if w.onTimeout != nil {
+			w.onTimeout()
+		}
+	})
+}
+
+// SetWatchdog enables a watchdog: if Update is not called for timeout, the gamepad is reset
+// to neutral, the neutral report is sent, EventWatchdogTimeout is published and onTimeout
+// (if not nil) is called. Running timed actions (Tap, Pulse, HoldLeftTrigger, tweens...) count
+// as updates. The watchdog is armed again by the next Update. A timeout of 0 disables it.
+func (g *VX360Gamepad) SetWatchdog(timeout time.Duration, onTimeout func()) {
+	g.setWatchdog(timeout, onTimeout, func() error {
+		g.reset()
+		return g.update()
+	})
+}
+
+// SetWatchdog enables a watchdog: if Update is not called for timeout, the gamepad is reset
+// to neutral, the neutral report is sent, EventWatchdogTimeout is published and onTimeout
+// (if not nil) is called. Running timed actions (Tap, Pulse, HoldLeftTrigger, tweens...) count
+// as updates. The watchdog is armed again by the next Update. A timeout of 0 disables it.
+func (g *VDS4Gamepad) SetWatchdog(timeout time.Duration, onTimeout func()) {
+	g.setWatchdog(timeout, onTimeout, func() error {
+		g.reset()
+		return g.update()
+	})
+}
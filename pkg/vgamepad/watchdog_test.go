@@ -0,0 +1,88 @@
+package vgamepad
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// watchedGamepad returns a plugged-in gamepad whose watchdog counts its neutralizations and timeouts
+func watchedGamepad(timeout time.Duration) (g *BaseGamepad, neutralized, timeouts *atomic.Int32) {
+	g = &BaseGamepad{devicep: 1}
+	neutralized, timeouts = &atomic.Int32{}, &atomic.Int32{}
+	g.setWatchdog(timeout, func() { timeouts.Add(1) }, func() error {
+		neutralized.Add(1)
+		return nil
+	})
+	return g, neutralized, timeouts
+}
+
+func TestWatchdogFiresOnce(t *testing.T) {
+	g, neutralized, timeouts := watchedGamepad(20 * time.Millisecond)
+	defer g.setWatchdog(0, nil, nil)
+
+	waitFor(t, "the watchdog to fire", func() bool { return timeouts.Load() == 1 })
+	if neutralized.Load() != 1 {
+		t.Error("the gamepad was not neutralized before onTimeout")
+	}
+	// Fired, it stays quiet until the next Update arms it again
+	time.Sleep(60 * time.Millisecond)
+	if timeouts.Load() != 1 {
+		t.Errorf("fired %d times without any update", timeouts.Load())
+	}
+	g.mu.Lock()
+	g.feedWatchdog()
+	g.mu.Unlock()
+	waitFor(t, "the watchdog to fire again", func() bool { return timeouts.Load() == 2 })
+}
+
+func TestWatchdogFedByUpdates(t *testing.T) {
+	g, _, timeouts := watchedGamepad(40 * time.Millisecond)
+	for i := 0; i < 6; i++ {
+		time.Sleep(15 * time.Millisecond)
+		g.mu.Lock()
+		g.feedWatchdog()
+		g.mu.Unlock()
+	}
+	if timeouts.Load() != 0 {
+		t.Error("the watchdog fired while the gamepad was updated")
+	}
+
+	// Disabled, it never fires
+	g.setWatchdog(0, nil, nil)
+	time.Sleep(80 * time.Millisecond)
+	if timeouts.Load() != 0 || g.watchdog != nil {
+		t.Error("a disabled watchdog fired")
+	}
+
+	// Nor does it on an unplugged gamepad
+	g, _, timeouts = watchedGamepad(10 * time.Millisecond)
+	g.mu.Lock()
+	g.devicep = 0
+	g.mu.Unlock()
+	time.Sleep(40 * time.Millisecond)
+	if timeouts.Load() != 0 {
+		t.Error("the watchdog fired on an unplugged gamepad")
+	}
+}
+
+func TestWatchdogWaitsForTimedActions(t *testing.T) {
+	g, _, timeouts := watchedGamepad(20 * time.Millisecond)
+	defer g.setWatchdog(0, nil, nil)
+
+	// A hold sends nothing between its press and its release, but keeps the watchdog quiet
+	a := g.hold(control{kind: controlLeftTrigger}, func() error { return nil }, func() {}, func() {}, 80*time.Millisecond)
+	if err := a.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	released := time.Now()
+	if timeouts.Load() != 0 {
+		t.Fatal("the watchdog fired during a timed action")
+	}
+
+	// The release counts as an update: the timeout runs from there
+	waitFor(t, "the watchdog to fire", func() bool { return timeouts.Load() == 1 })
+	if elapsed := time.Since(released); elapsed < 10*time.Millisecond {
+		t.Errorf("fired %v after the action ended", elapsed)
+	}
+}
@@ -3,7 +3,9 @@ package vgamepad
 import (
 	"fmt"
 	"math"
+	"runtime"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/CB2Moon/vgamepad-go/internal/vigem"
@@ -18,13 +20,12 @@ type VX360Gamepad struct {
 
 // NewVX360Gamepad creates a new virtual Xbox 360 gamepad
 func NewVX360Gamepad() (*VX360Gamepad, error) {
-	base, err := NewBaseGamepad(func() (uintptr, error) {
-		client, err := vigem.NewViGEmClient()
-		if err != nil {
-			return 0, err
-		}
-		return client.TargetX360Alloc()
-	})
+	return newVX360Gamepad(0, 0)
+}
+
+// newVX360Gamepad creates a new virtual Xbox 360 gamepad with the given vendor and product IDs (0 keeps the default)
+func newVX360Gamepad(vid, pid uint16) (*VX360Gamepad, error) {
+	base, err := newBaseGamepad((*vigem.ViGEmClient).TargetX360Alloc, vid, pid)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +42,11 @@ func NewVX360Gamepad() (*VX360Gamepad, error) {
 		return nil, err
 	}
 
+	// Safety net for gamepads dropped without being closed. It only works for gamepads
+	// no background work refers to any more: turbo, a watchdog, reconnection or running
+	// timed actions keep them reachable until Close.
+	runtime.SetFinalizer(gamepad, (*VX360Gamepad).Close)
+
 	return gamepad, nil
 }
 
@@ -59,70 +65,281 @@ func getDefaultX360Report() commons.XUSBReport {
 
 // Reset resets the gamepad to default state
 func (g *VX360Gamepad) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.reset()
+}
+
+// restoreDefaults resets the report and every setting, and unregisters the notification,
+// so that the gamepad is as if it had just been created. Call Update to send the report.
+func (g *VX360Gamepad) restoreDefaults() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmpFunc != nil {
+		g.client.TargetX360UnregisterNotification(g.devicep)
+		g.cmpFunc = nil
+	}
+	g.resetSettings()
+	g.reset()
+}
+
+// reset resets the gamepad without locking (g.mu must be held)
+func (g *VX360Gamepad) reset() {
+	g.disownAll()
+	g.resetLatches()
 	g.report = getDefaultX360Report()
+	g.noteDPad(0)
+}
+
+// SetReport replaces the whole report, e.g. with a report built elsewhere
+func (g *VX360Gamepad) SetReport(report commons.XUSBReport) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disownAll()
+	g.report = report
+	g.noteDPad(report.WButtons)
+}
+
+// mergeReport replaces the report like SetReport, except for the controls owned by timed actions,
+// which keep their values and their actions
+func (g *VX360Gamepad) mergeReport(report commons.XUSBReport) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for a := range g.actions {
+		switch c := a.control; c.kind {
+		case controlButton:
+			report.WButtons = report.WButtons&^c.mask | g.report.WButtons&c.mask
+		case controlLeftTrigger:
+			report.BLeftTrigger = g.report.BLeftTrigger
+		case controlRightTrigger:
+			report.BRightTrigger = g.report.BRightTrigger
+		case controlLeftJoystick:
+			report.SThumbLX, report.SThumbLY = g.report.SThumbLX, g.report.SThumbLY
+		case controlRightJoystick:
+			report.SThumbRX, report.SThumbRY = g.report.SThumbRX, g.report.SThumbRY
+		}
+	}
+	g.report = report
+	g.noteDPad(report.WButtons)
+}
+
+// GetReport returns the current report, before SOCD cleaning, turbo and humanization
+func (g *VX360Gamepad) GetReport() commons.XUSBReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.report
 }
 
 // Update sends the current report to the virtual device
 func (g *VX360Gamepad) Update() error {
-	return g.client.TargetX360Update(g.busp, g.devicep, g.report)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.feedWatchdog()
+	if err := g.takeInputError(); err != nil {
+		return err
+	}
+	if err := g.selfHeal(g.update()); err != nil {
+		g.publish(EventUpdateError, err)
+		return err
+	}
+	return nil
+}
+
+// update sends the current report without locking (g.mu must be held)
+func (g *VX360Gamepad) update() error {
+	err := g.client.TargetX360Update(g.busp, g.devicep, g.buildReport())
+	g.wakeRefresh()
+	return err
+}
+
+// buildReport returns the report to send, i.e. the current report with SOCD cleaning, turbo and humanization applied
+func (g *VX360Gamepad) buildReport() commons.XUSBReport {
+	report := g.report
+	now := time.Now()
+	dpad := uint16(commons.XUSB_GAMEPAD_DPAD)
+	g.noteDPad(report.WButtons)
+	report.WButtons = report.WButtons&^dpad | g.resolveSOCD(report.WButtons&dpad)
+	report.WButtons = applyButtonTurbo(g.turbos, controlButton, report.WButtons, now)
+	report.BLeftTrigger = applyTriggerTurbo(g.turbos, controlLeftTrigger, report.BLeftTrigger, now)
+	report.BRightTrigger = applyTriggerTurbo(g.turbos, controlRightTrigger, report.BRightTrigger, now)
+	g.humanize(&report, now)
+	return report
 }
 
 // PressButton presses a button (no effect if already pressed)
 func (g *VX360Gamepad) PressButton(button commons.XUSBButton) {
-	g.report.WButtons = g.report.WButtons | uint16(button)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: uint16(button)})
+	g.setButtons(g.pressLatched(controlButton, uint16(button)), true)
 }
 
 // ReleaseButton releases a button (no effect if already released)
 func (g *VX360Gamepad) ReleaseButton(button commons.XUSBButton) {
-	g.report.WButtons = g.report.WButtons &^ uint16(button)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlButton, mask: uint16(button)})
+	g.setButtons(g.releaseLatched(controlButton, uint16(button)), false)
 }
 
 // LeftTrigger sets the value (0-255, 0 = trigger released) of the left trigger
 func (g *VX360Gamepad) LeftTrigger(value uint8) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftTrigger})
 	g.report.BLeftTrigger = value
 }
 
 // RightTrigger sets the value (0-255, 0 = trigger released) of the right trigger
 func (g *VX360Gamepad) RightTrigger(value uint8) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightTrigger})
 	g.report.BRightTrigger = value
 }
 
 // LeftTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the left trigger using a float
 func (g *VX360Gamepad) LeftTriggerFloat(valueFloat float64) {
-	g.LeftTrigger(uint8(math.Round(valueFloat * 255)))
+	if !g.checkInput("LeftTriggerFloat", 0, 1, valueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftTrigger})
+	g.leftTriggerFloat(valueFloat)
 }
 
 // RightTriggerFloat sets the value (0.0-1.0, 0.0 = trigger released) of the right trigger using a float
 func (g *VX360Gamepad) RightTriggerFloat(valueFloat float64) {
-	g.RightTrigger(uint8(math.Round(valueFloat * 255)))
+	if !g.checkInput("RightTriggerFloat", 0, 1, valueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightTrigger})
+	g.rightTriggerFloat(valueFloat)
+}
+
+// leftTriggerFloat runs a float value through the pipeline of the left trigger and sets it,
+// without locking or taking ownership (g.mu must be held)
+func (g *VX360Gamepad) leftTriggerFloat(valueFloat float64) {
+	g.report.BLeftTrigger = triggerFromFloat(g.leftTrigger.apply(valueFloat))
+}
+
+// rightTriggerFloat runs a float value through the pipeline of the right trigger and sets it,
+// without locking or taking ownership (g.mu must be held)
+func (g *VX360Gamepad) rightTriggerFloat(valueFloat float64) {
+	g.report.BRightTrigger = triggerFromFloat(g.rightTrigger.apply(valueFloat))
+}
+
+// GetLeftTriggerFloat returns the value (0.0-1.0) of the left trigger
+func (g *VX360Gamepad) GetLeftTriggerFloat() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return triggerToFloat(g.report.BLeftTrigger)
+}
+
+// GetRightTriggerFloat returns the value (0.0-1.0) of the right trigger
+func (g *VX360Gamepad) GetRightTriggerFloat() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return triggerToFloat(g.report.BRightTrigger)
 }
 
 // LeftJoystick sets the values (-32768 to 32768, 0 = neutral position) of the X and Y axis for the left joystick
 func (g *VX360Gamepad) LeftJoystick(xValue, yValue int16) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftJoystick})
 	g.report.SThumbLX = xValue
 	g.report.SThumbLY = yValue
 }
 
 // RightJoystick sets the values (-32768 to 32768, 0 = neutral position) of the X and Y axis for the right joystick
 func (g *VX360Gamepad) RightJoystick(xValue, yValue int16) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightJoystick})
 	g.report.SThumbRX = xValue
 	g.report.SThumbRY = yValue
 }
 
-// LeftJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the left joystick using floats
+// LeftJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the left joystick using floats.
+// Y points up (1.0 = up).
 func (g *VX360Gamepad) LeftJoystickFloat(xValueFloat, yValueFloat float64) {
-	g.LeftJoystick(
-		int16(math.Round(xValueFloat*32767)),
-		int16(math.Round(yValueFloat*32767)),
-	)
+	if !g.checkInput("LeftJoystickFloat", -1, 1, xValueFloat, yValueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlLeftJoystick})
+	g.leftJoystickFloat(xValueFloat, yValueFloat)
 }
 
-// RightJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the right joystick using floats
+// GetLeftJoystickFloat returns the values (-1.0 to 1.0) of the X and Y axis of the left joystick, Y pointing up
+func (g *VX360Gamepad) GetLeftJoystickFloat() (float64, float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return x360AxisToFloat(g.report.SThumbLX), x360AxisToFloat(g.report.SThumbLY)
+}
+
+// RightJoystickFloat sets the values (-1.0 to 1.0, 0 = neutral position) of the X and Y axis for the right joystick using floats.
+// Y points up (1.0 = up).
 func (g *VX360Gamepad) RightJoystickFloat(xValueFloat, yValueFloat float64) {
-	g.RightJoystick(
-		int16(math.Round(xValueFloat*32767)),
-		int16(math.Round(yValueFloat*32767)),
-	)
+	if !g.checkInput("RightJoystickFloat", -1, 1, xValueFloat, yValueFloat) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.disown(control{kind: controlRightJoystick})
+	g.rightJoystickFloat(xValueFloat, yValueFloat)
+}
+
+// leftJoystickFloat runs float values through the pipeline of the left joystick and sets them,
+// without locking or taking ownership (g.mu must be held)
+func (g *VX360Gamepad) leftJoystickFloat(xValueFloat, yValueFloat float64) {
+	xValueFloat, yValueFloat = g.leftStick.apply(xValueFloat, yValueFloat)
+	g.report.SThumbLX = x360AxisFromFloat(xValueFloat)
+	g.report.SThumbLY = x360AxisFromFloat(yValueFloat)
+}
+
+// rightJoystickFloat runs float values through the pipeline of the right joystick and sets them,
+// without locking or taking ownership (g.mu must be held)
+func (g *VX360Gamepad) rightJoystickFloat(xValueFloat, yValueFloat float64) {
+	xValueFloat, yValueFloat = g.rightStick.apply(xValueFloat, yValueFloat)
+	g.report.SThumbRX = x360AxisFromFloat(xValueFloat)
+	g.report.SThumbRY = x360AxisFromFloat(yValueFloat)
+}
+
+// GetRightJoystickFloat returns the values (-1.0 to 1.0) of the X and Y axis of the right joystick, Y pointing up
+func (g *VX360Gamepad) GetRightJoystickFloat() (float64, float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return x360AxisToFloat(g.report.SThumbRX), x360AxisToFloat(g.report.SThumbRY)
 }
 
 // RegisterNotification registers a callback function for notifications
@@ -133,18 +350,35 @@ func (g *VX360Gamepad) RegisterNotification(callback NotificationCallback) error
 		return 0
 	})
 
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	g.cmpFunc = unsafe.Pointer(&callbackPtr)
 
 	err := g.client.TargetX360RegisterNotification(g.busp, g.devicep, uintptr(g.cmpFunc), 0)
 	if err != nil {
 		return fmt.Errorf("failed to register notification: %w", err)
 	}
+	g.publish(EventNotificationRegistered, nil)
 
 	return nil
 }
 
 // UnregisterNotification unregisters a previously registered callback function
 func (g *VX360Gamepad) UnregisterNotification() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	g.client.TargetX360UnregisterNotification(g.devicep)
 	g.cmpFunc = nil
 }
+
+// x360AxisFromFloat converts a joystick axis value from [-1.0, 1.0] to [-32767, 32767], clamping it
+func x360AxisFromFloat(value float64) int16 {
+	return int16(math.Round(clampFloat(value, -1, 1) * 32767))
+}
+
+// x360AxisToFloat converts a joystick axis value from [-32768, 32767] to [-1.0, 1.0]
+func x360AxisToFloat(value int16) float64 {
+	return math.Max(float64(value)/32767, -1)
+}